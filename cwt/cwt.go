@@ -2,30 +2,32 @@ package cwt
 
 import (
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"time"
 
 	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
 )
 
 const DefaultIssuer = "relay-control-plane"
 
 // GenerateDocToken creates a CWT token for document access.
 // Authorization should be "full" (→ rw) or "read-only" (→ r).
-func GenerateDocToken(key []byte, keyId string, issuer string, docId string, userId string, audience string, authorization string, expirySeconds int) (string, error) {
-	suffix := authSuffix(authorization)
-	scope := fmt.Sprintf("doc:%s:%s", docId, suffix)
-	return generateToken(key, keyId, issuer, userId, audience, scope, expirySeconds)
+func GenerateDocToken(key Key, issuer string, docId string, userId string, audience string, authorization string, expirySeconds int) (string, error) {
+	return generateToken(key, issuer, userId, audience, DocScope(docId, authorization), expirySeconds)
 }
 
 // GenerateFileToken creates a CWT token for file access.
 // Authorization should be "full" (→ rw) or "read-only" (→ r).
-func GenerateFileToken(key []byte, keyId string, issuer string, docId string, userId string, audience string, authorization string, expirySeconds int, fileHash string) (string, error) {
-	suffix := authSuffix(authorization)
-	scope := fmt.Sprintf("file:%s:%s:%s", fileHash, docId, suffix)
-	return generateToken(key, keyId, issuer, userId, audience, scope, expirySeconds)
+func GenerateFileToken(key Key, issuer string, docId string, userId string, audience string, authorization string, expirySeconds int, fileHash string) (string, error) {
+	return generateToken(key, issuer, userId, audience, FileScope(fileHash, docId, authorization), expirySeconds)
 }
 
 func authSuffix(authorization string) string {
@@ -35,28 +37,83 @@ func authSuffix(authorization string) string {
 	return "r"
 }
 
-func generateToken(key []byte, keyId string, issuer string, userId string, audience string, scope string, expirySeconds int) (string, error) {
-	now := uint64(time.Now().Unix())
-	exp := now + uint64(expirySeconds)
-	if issuer == "" {
-		issuer = DefaultIssuer
+// NewTokenID returns a random token identifier for the cti claim, hex encoded.
+func NewTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func generateToken(key Key, issuer string, userId string, audience string, scope Scope, expirySeconds int) (string, error) {
+	now := time.Now()
+	return Issue(key, Claims{
+		Issuer:    issuer,
+		Subject:   userId,
+		Audience:  audience,
+		ExpiresAt: now.Add(time.Duration(expirySeconds) * time.Second),
+		IssuedAt:  now,
+		Scopes:    []Scope{scope},
+	})
+}
+
+// Issue creates a CWT carrying the given claims, protected with key.
+// IssuedAt defaults to now and Issuer to DefaultIssuer.
+func Issue(key Key, claims Claims) (string, error) {
+	if claims.IssuedAt.IsZero() {
+		claims.IssuedAt = time.Now()
+	}
+	if claims.Issuer == "" {
+		claims.Issuer = DefaultIssuer
 	}
 
-	claims := buildClaimsMap(issuer, userId, audience, exp, now, scope)
-	payload, err := cbor.Marshal(claims)
+	claimsMap, err := buildClaimsMap(claims)
+	if err != nil {
+		return "", err
+	}
+	payload, err := cbor.Marshal(claimsMap)
 	if err != nil {
 		return "", fmt.Errorf("encoding claims: %w", err)
 	}
 
-	protectedHeaders := buildProtectedHeaders(keyId)
+	var coseBytes []byte
+	switch key.Type {
+	case KeyTypeHMAC:
+		coseBytes, err = encodeMac0(key, payload)
+	case KeyTypeEd25519, KeyTypeES256:
+		coseBytes, err = encodeSign1(key, payload)
+	case KeyTypeA256GCM:
+		coseBytes, err = encodeEncrypt0(key, payload)
+	default:
+		err = fmt.Errorf("unsupported key type %q", key.Type)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Wrap the tagged COSE message with CBOR tag 61 (CWT)
+	tagged61 := cbor.Tag{Number: 61, Content: cbor.RawMessage(coseBytes)}
+	cwtBytes, err := cbor.Marshal(tagged61)
+	if err != nil {
+		return "", fmt.Errorf("encoding CWT tag: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(cwtBytes), nil
+}
+
+// encodeMac0 builds a COSE_Mac0 message wrapped in CBOR tag 17.
+func encodeMac0(key Key, payload []byte) ([]byte, error) {
+	alg := key.macAlgorithm()
+	protectedHeaders := buildProtectedHeaders(key.ID, alg)
 	protectedBytes, err := cbor.Marshal(protectedHeaders)
 	if err != nil {
-		return "", fmt.Errorf("encoding protected headers: %w", err)
+		return nil, fmt.Errorf("encoding protected headers: %w", err)
 	}
 
-	tag, err := computeMAC(protectedBytes, payload, key)
+	tag, err := computeMAC(alg, protectedBytes, payload, key.Secret)
 	if err != nil {
-		return "", fmt.Errorf("computing MAC: %w", err)
+		return nil, fmt.Errorf("computing MAC: %w", err)
 	}
 
 	// COSE_Mac0 = [protected, unprotected, payload, tag]
@@ -69,49 +126,131 @@ func generateToken(key []byte, keyId string, issuer string, userId string, audie
 
 	coseMac0Bytes, err := cbor.Marshal(coseMac0)
 	if err != nil {
-		return "", fmt.Errorf("encoding COSE_Mac0: %w", err)
+		return nil, fmt.Errorf("encoding COSE_Mac0: %w", err)
 	}
 
-	// Wrap with CBOR tag 17 (COSE_Mac0), then tag 61 (CWT)
 	tagged17 := cbor.Tag{Number: 17, Content: cbor.RawMessage(coseMac0Bytes)}
 	tagged17Bytes, err := cbor.Marshal(tagged17)
 	if err != nil {
-		return "", fmt.Errorf("encoding COSE_Mac0 tag: %w", err)
+		return nil, fmt.Errorf("encoding COSE_Mac0 tag: %w", err)
 	}
+	return tagged17Bytes, nil
+}
 
-	tagged61 := cbor.Tag{Number: 61, Content: cbor.RawMessage(tagged17Bytes)}
-	cwtBytes, err := cbor.Marshal(tagged61)
+// encodeSign1 builds a COSE_Sign1 message wrapped in CBOR tag 18.
+func encodeSign1(key Key, payload []byte) ([]byte, error) {
+	alg, err := key.signatureAlgorithm()
 	if err != nil {
-		return "", fmt.Errorf("encoding CWT tag: %w", err)
+		return nil, err
+	}
+	signer, err := cose.NewSigner(alg, key.Signer)
+	if err != nil {
+		return nil, fmt.Errorf("creating signer: %w", err)
 	}
 
-	return base64.RawURLEncoding.EncodeToString(cwtBytes), nil
+	msg := cose.NewSign1Message()
+	msg.Headers.Protected.SetAlgorithm(alg)
+	msg.Headers.Protected[cose.HeaderLabelKeyID] = []byte(key.ID)
+	msg.Payload = payload
+
+	if err := msg.Sign(rand.Reader, nil, signer); err != nil {
+		return nil, fmt.Errorf("signing COSE_Sign1: %w", err)
+	}
+
+	tagged18Bytes, err := msg.MarshalCBOR()
+	if err != nil {
+		return nil, fmt.Errorf("encoding COSE_Sign1: %w", err)
+	}
+	return tagged18Bytes, nil
 }
 
 // buildClaimsMap builds a CBOR map with integer keys per CWT spec.
-func buildClaimsMap(issuer, subject, audience string, exp, iat uint64, scope string) map[int64]any {
-	return map[int64]any{
-		1:      issuer,   // iss
-		2:      subject,  // sub
-		3:      audience, // aud
-		4:      exp,      // exp
-		6:      iat,      // iat
-		-80201: scope,    // scope (private claim)
+func buildClaimsMap(c Claims) (map[int64]any, error) {
+	claims := map[int64]any{
+		1: c.Issuer,                   // iss
+		2: c.Subject,                  // sub
+		3: c.Audience,                 // aud
+		4: uint64(c.ExpiresAt.Unix()), // exp
+		6: uint64(c.IssuedAt.Unix()),  // iat
+	}
+	if !c.NotBefore.IsZero() {
+		claims[5] = uint64(c.NotBefore.Unix()) // nbf
+	}
+
+	// scope (private claim): a single string, or an array for multi-scope tokens
+	if len(c.Scopes) == 0 {
+		return nil, errors.New("token must have at least one scope")
+	}
+	scopes := make([]string, len(c.Scopes))
+	for i, scope := range c.Scopes {
+		if err := scope.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid scope: %w", err)
+		}
+		scopes[i] = scope.String()
+	}
+	if len(scopes) == 1 {
+		claims[-80201] = scopes[0]
+	} else {
+		claims[-80201] = scopes
 	}
+
+	if c.ID != "" {
+		cti, err := hex.DecodeString(c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token id: %w", err)
+		}
+		claims[7] = cti // cti
+	}
+	return claims, nil
 }
 
 // buildProtectedHeaders builds the COSE protected headers map.
-// Key 1 = algorithm (4 = HMAC_256_64), Key 4 = key_id.
-func buildProtectedHeaders(keyId string) map[int]any {
+// Key 1 = algorithm (4-7 = HMAC), Key 4 = key_id.
+func buildProtectedHeaders(keyId string, alg int64) map[int]any {
 	return map[int]any{
-		1: 4,             // alg: HMAC 256/64
+		1: alg,           // alg: HMAC
 		4: []byte(keyId), // kid
 	}
 }
 
-// computeMAC computes HMAC-SHA-256 over the MAC_structure, truncated to 8 bytes.
+// COSE HMAC algorithms (RFC 9053 section 3.1).
+const (
+	AlgHMAC256Trunc64 int64 = 4 // HMAC 256/64, the default
+	AlgHMAC256        int64 = 5 // HMAC 256/256
+	AlgHMAC384        int64 = 6 // HMAC 384/384
+	AlgHMAC512        int64 = 7 // HMAC 512/512
+)
+
+// macParams returns the hash function and tag length for a COSE HMAC algorithm.
+func macParams(alg int64) (func() hash.Hash, int, error) {
+	switch alg {
+	case AlgHMAC256Trunc64:
+		return sha256.New, 8, nil
+	case AlgHMAC256:
+		return sha256.New, 32, nil
+	case AlgHMAC384:
+		return sha512.New384, 48, nil
+	case AlgHMAC512:
+		return sha512.New, 64, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported MAC algorithm %d", alg)
+}
+
+// IsMACAlgorithm reports whether alg is a supported COSE HMAC algorithm.
+func IsMACAlgorithm(alg int64) bool {
+	_, _, err := macParams(alg)
+	return err == nil
+}
+
+// computeMAC computes the HMAC over the MAC_structure, truncated to the
+// algorithm's tag length.
 // MAC_structure = ['MAC0', protected_bytes, external_aad, payload]
-func computeMAC(protectedBytes, payload, key []byte) ([]byte, error) {
+func computeMAC(alg int64, protectedBytes, payload, key []byte) ([]byte, error) {
+	newHash, tagLen, err := macParams(alg)
+	if err != nil {
+		return nil, err
+	}
+
 	macStructure := []any{
 		"MAC0",
 		protectedBytes,
@@ -124,11 +263,11 @@ func computeMAC(protectedBytes, payload, key []byte) ([]byte, error) {
 		return nil, fmt.Errorf("encoding MAC_structure: %w", err)
 	}
 
-	mac := hmac.New(sha256.New, key)
+	mac := hmac.New(newHash, key)
 	mac.Write(macInput)
 	fullMAC := mac.Sum(nil)
 
-	return fullMAC[:8], nil
+	return fullMAC[:tagLen], nil
 }
 
 func mustMarshal(v any) cbor.RawMessage {
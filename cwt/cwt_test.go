@@ -7,12 +7,13 @@ import (
 	"github.com/fxamacker/cbor/v2"
 )
 
-var testKey = []byte("test_key_1234567890123456789012")
+var testSecret = []byte("test_key_1234567890123456789012")
 var testKeyId = "test-key-id"
+var testKey = NewHMACKey(testKeyId, testSecret)
 var testIssuer = "test-control-plane"
 
 func TestGenerateDocToken_Base64Decodable(t *testing.T) {
-	token, err := GenerateDocToken(testKey, testKeyId, testIssuer, "doc123", "user1", "https://relay.example.com", "full", 3600)
+	token, err := GenerateDocToken(testKey, testIssuer, "doc123", "user1", "https://relay.example.com", "full", 3600)
 	if err != nil {
 		t.Fatalf("GenerateDocToken failed: %v", err)
 	}
@@ -24,7 +25,7 @@ func TestGenerateDocToken_Base64Decodable(t *testing.T) {
 }
 
 func TestGenerateDocToken_CWTTag61(t *testing.T) {
-	token, err := GenerateDocToken(testKey, testKeyId, testIssuer, "doc123", "user1", "https://relay.example.com", "full", 3600)
+	token, err := GenerateDocToken(testKey, testIssuer, "doc123", "user1", "https://relay.example.com", "full", 3600)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -41,7 +42,7 @@ func TestGenerateDocToken_CWTTag61(t *testing.T) {
 }
 
 func TestGenerateDocToken_COSEMac0Tag17(t *testing.T) {
-	token, err := GenerateDocToken(testKey, testKeyId, testIssuer, "doc123", "user1", "https://relay.example.com", "full", 3600)
+	token, err := GenerateDocToken(testKey, testIssuer, "doc123", "user1", "https://relay.example.com", "full", 3600)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -69,7 +70,7 @@ func TestGenerateDocToken_COSEMac0Tag17(t *testing.T) {
 }
 
 func TestGenerateDocToken_ProtectedHeaders(t *testing.T) {
-	token, err := GenerateDocToken(testKey, testKeyId, testIssuer, "doc123", "user1", "https://relay.example.com", "full", 3600)
+	token, err := GenerateDocToken(testKey, testIssuer, "doc123", "user1", "https://relay.example.com", "full", 3600)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -107,7 +108,7 @@ func TestGenerateDocToken_ProtectedHeaders(t *testing.T) {
 }
 
 func TestGenerateDocToken_ClaimsKeys(t *testing.T) {
-	token, err := GenerateDocToken(testKey, testKeyId, testIssuer, "doc123", "user1", "https://relay.example.com", "full", 3600)
+	token, err := GenerateDocToken(testKey, testIssuer, "doc123", "user1", "https://relay.example.com", "full", 3600)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -134,7 +135,7 @@ func TestGenerateDocToken_ClaimsKeys(t *testing.T) {
 }
 
 func TestGenerateDocToken_HMACTag8Bytes(t *testing.T) {
-	token, err := GenerateDocToken(testKey, testKeyId, testIssuer, "doc123", "user1", "https://relay.example.com", "full", 3600)
+	token, err := GenerateDocToken(testKey, testIssuer, "doc123", "user1", "https://relay.example.com", "full", 3600)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -152,7 +153,7 @@ func TestGenerateDocToken_HMACTag8Bytes(t *testing.T) {
 }
 
 func TestGenerateDocToken_CustomIssuer(t *testing.T) {
-	token, err := GenerateDocToken(testKey, testKeyId, testIssuer, "doc123", "user1", "https://relay.example.com", "full", 3600)
+	token, err := GenerateDocToken(testKey, testIssuer, "doc123", "user1", "https://relay.example.com", "full", 3600)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -172,7 +173,7 @@ func TestGenerateDocToken_ScopeFormats(t *testing.T) {
 		{"read-only", "doc:doc123:r"},
 	}
 	for _, tt := range tests {
-		token, err := GenerateDocToken(testKey, testKeyId, testIssuer, "doc123", "user1", "https://relay.example.com", tt.auth, 3600)
+		token, err := GenerateDocToken(testKey, testIssuer, "doc123", "user1", "https://relay.example.com", tt.auth, 3600)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -192,7 +193,7 @@ func TestGenerateFileToken_ScopeFormats(t *testing.T) {
 		{"read-only", "file:abc123:doc456:r"},
 	}
 	for _, tt := range tests {
-		token, err := GenerateFileToken(testKey, testKeyId, testIssuer, "doc456", "user1", "https://relay.example.com", tt.auth, 3600, "abc123")
+		token, err := GenerateFileToken(testKey, testIssuer, "doc456", "user1", "https://relay.example.com", tt.auth, 3600, "abc123")
 		if err != nil {
 			t.Fatal(err)
 		}
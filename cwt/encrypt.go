@@ -0,0 +1,106 @@
+package cwt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// AlgA256GCM is the COSE algorithm ID for AES-GCM with a 256-bit key.
+const AlgA256GCM int64 = 3
+
+// encodeEncrypt0 builds a COSE_Encrypt0 message wrapped in CBOR tag 16.
+// The claims are encrypted with AES-256-GCM, so only holders of the key can
+// read them; GCM's authentication tag stands in for the MAC.
+func encodeEncrypt0(key Key, payload []byte) ([]byte, error) {
+	aead, err := newGCM(key.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	protectedBytes, err := cbor.Marshal(map[int]any{
+		1: AlgA256GCM,     // alg: A256GCM
+		4: []byte(key.ID), // kid
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding protected headers: %w", err)
+	}
+
+	iv := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	aad, err := encStructure(protectedBytes)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := aead.Seal(nil, iv, payload, aad)
+
+	// COSE_Encrypt0 = [protected, unprotected, ciphertext]
+	coseEncrypt0 := []cbor.RawMessage{
+		mustMarshal(protectedBytes),     // bstr-wrapped protected headers
+		mustMarshal(map[int]any{5: iv}), // unprotected headers: IV
+		mustMarshal(ciphertext),         // bstr-wrapped ciphertext
+	}
+	coseEncrypt0Bytes, err := cbor.Marshal(coseEncrypt0)
+	if err != nil {
+		return nil, fmt.Errorf("encoding COSE_Encrypt0: %w", err)
+	}
+
+	tagged16 := cbor.Tag{Number: coseEncrypt0Tag, Content: cbor.RawMessage(coseEncrypt0Bytes)}
+	tagged16Bytes, err := cbor.Marshal(tagged16)
+	if err != nil {
+		return nil, fmt.Errorf("encoding COSE_Encrypt0 tag: %w", err)
+	}
+	return tagged16Bytes, nil
+}
+
+// decrypt opens the ciphertext of a COSE_Encrypt0 token and decodes its
+// claims.
+func (t *Token) decrypt(key Key) error {
+	if key.Type != KeyTypeA256GCM || t.Algorithm != AlgA256GCM {
+		return ErrDecryption
+	}
+	aead, err := newGCM(key.Secret)
+	if err != nil {
+		return ErrDecryption
+	}
+	if len(t.iv) != aead.NonceSize() {
+		return fmt.Errorf("%w: bad IV length", ErrMalformed)
+	}
+	aad, err := encStructure(t.protected)
+	if err != nil {
+		return err
+	}
+
+	payload, err := aead.Open(nil, t.iv, t.tag, aad)
+	if err != nil {
+		return ErrDecryption
+	}
+	t.payload = payload
+	return t.decodeClaims()
+}
+
+// encStructure builds the Enc_structure used as additional authenticated data.
+func encStructure(protected []byte) ([]byte, error) {
+	// Enc_structure = ["Encrypt0", protected, external_aad]
+	data, err := cbor.Marshal([]any{"Encrypt0", protected, []byte{}})
+	if err != nil {
+		return nil, fmt.Errorf("encoding Enc_structure: %w", err)
+	}
+	return data, nil
+}
+
+func newGCM(secret []byte) (cipher.AEAD, error) {
+	if len(secret) != 32 {
+		return nil, fmt.Errorf("A256GCM key must be 32 bytes, got %d", len(secret))
+	}
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
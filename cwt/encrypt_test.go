@@ -0,0 +1,81 @@
+package cwt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestVerify_Encrypt0(t *testing.T) {
+	key, err := GenerateKey("enc-key", KeyTypeA256GCM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := GenerateFileToken(key, testIssuer, "doc456", "user1", testAudience, "full", 3600, "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := Parse(token)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if parsed.KeyID != "enc-key" || parsed.Algorithm != AlgA256GCM {
+		t.Errorf("unexpected headers kid=%q alg=%d", parsed.KeyID, parsed.Algorithm)
+	}
+	if parsed.Claims.Subject != "" || len(parsed.Claims.Scopes) != 0 {
+		t.Errorf("expected claims to stay encrypted before VerifyKey, got %+v", parsed.Claims)
+	}
+
+	raw, _ := base64.RawURLEncoding.DecodeString(token)
+	if bytes.Contains(raw, []byte("user1")) || bytes.Contains(raw, []byte("abc123")) {
+		t.Error("claims appear in plaintext")
+	}
+
+	// Relays hold the same secret, exposed through PublicKey.
+	secret, _ := key.PublicKey()
+	relayKey, err := ParsePublicKey("enc-key", KeyTypeA256GCM, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := Verify(token, NewKeyring(relayKey), VerifyOptions{Issuer: testIssuer, Audience: testAudience})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	want := FileScope("abc123", "doc456", "full")
+	if claims.Subject != "user1" || len(claims.Scopes) != 1 || claims.Scopes[0] != want {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+}
+
+func TestVerify_Encrypt0Rejects(t *testing.T) {
+	key, _ := GenerateKey("enc-key", KeyTypeA256GCM)
+	token, err := GenerateDocToken(key, testIssuer, "doc123", "user1", testAudience, "full", 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey, _ := GenerateKey("enc-key", KeyTypeA256GCM)
+	if _, err := Verify(token, NewKeyring(otherKey), VerifyOptions{}); !errors.Is(err, ErrDecryption) {
+		t.Errorf("wrong key: expected ErrDecryption, got %v", err)
+	}
+
+	hmacKey := NewHMACKey("enc-key", key.Secret)
+	if _, err := Verify(token, NewKeyring(hmacKey), VerifyOptions{}); !errors.Is(err, ErrDecryption) {
+		t.Errorf("HMAC key: expected ErrDecryption, got %v", err)
+	}
+
+	raw, _ := base64.RawURLEncoding.DecodeString(token)
+	raw[len(raw)-1] ^= 0xff
+	tampered := base64.RawURLEncoding.EncodeToString(raw)
+	if _, err := Verify(tampered, NewKeyring(key), VerifyOptions{}); !errors.Is(err, ErrDecryption) {
+		t.Errorf("tampered: expected ErrDecryption, got %v", err)
+	}
+}
+
+func TestParsePrivateKey_A256GCMSize(t *testing.T) {
+	if _, err := ParsePrivateKey("k", KeyTypeA256GCM, make([]byte, 16)); err == nil {
+		t.Error("expected error for 16-byte A256GCM key")
+	}
+}
@@ -0,0 +1,213 @@
+package cwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/veraison/go-cose"
+)
+
+// KeyType identifies how a token is protected. The values match the
+// key_type field stored on provider records.
+type KeyType string
+
+const (
+	KeyTypeHMAC    KeyType = "hmac"
+	KeyTypeEd25519 KeyType = "ed25519"
+	KeyTypeES256   KeyType = "es256"
+	KeyTypeA256GCM KeyType = "a256gcm"
+)
+
+// Symmetric reports whether the relay needs the same secret bytes as the
+// control plane to validate tokens of this type.
+func (t KeyType) Symmetric() bool {
+	return t == KeyTypeHMAC || t == KeyTypeA256GCM
+}
+
+// Key describes the key material used to protect a token.
+// HMAC keys carry a shared Secret and produce COSE_Mac0 tokens.
+// Ed25519 and ES256 keys carry a private Signer and produce COSE_Sign1
+// tokens, so relays only need the matching public key. Verification-only
+// keys set Public instead of Signer. A256GCM keys carry a 32-byte Secret and
+// produce COSE_Encrypt0 tokens whose claims are unreadable without it.
+type Key struct {
+	ID     string
+	Type   KeyType
+	Secret []byte
+	Signer crypto.Signer
+	Public crypto.PublicKey
+
+	// MACAlgorithm selects the COSE HMAC algorithm for HMAC keys.
+	// Zero means AlgHMAC256Trunc64.
+	MACAlgorithm int64
+}
+
+// NewHMACKey returns an HMAC key descriptor for the given shared secret.
+func NewHMACKey(id string, secret []byte) Key {
+	return Key{ID: id, Type: KeyTypeHMAC, Secret: secret}
+}
+
+// ParseKeyType converts a provider key_type value to a KeyType.
+// An empty value is treated as HMAC for compatibility with older records.
+func ParseKeyType(s string) (KeyType, error) {
+	switch KeyType(s) {
+	case "", KeyTypeHMAC:
+		return KeyTypeHMAC, nil
+	case KeyTypeEd25519, KeyTypeES256, KeyTypeA256GCM:
+		return KeyType(s), nil
+	}
+	return "", fmt.Errorf("unsupported key type %q", s)
+}
+
+// GenerateKey creates a new random key of the given type.
+func GenerateKey(id string, keyType KeyType) (Key, error) {
+	switch keyType {
+	case KeyTypeHMAC:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return Key{}, err
+		}
+		return NewHMACKey(id, secret), nil
+	case KeyTypeA256GCM:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return Key{}, err
+		}
+		return Key{ID: id, Type: keyType, Secret: secret}, nil
+	case KeyTypeEd25519:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return Key{}, err
+		}
+		return Key{ID: id, Type: keyType, Signer: priv}, nil
+	case KeyTypeES256:
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return Key{}, err
+		}
+		return Key{ID: id, Type: keyType, Signer: priv}, nil
+	}
+	return Key{}, fmt.Errorf("unsupported key type %q", keyType)
+}
+
+// ParsePrivateKey builds a key descriptor from PKCS#8 DER bytes.
+// Symmetric keys are not DER encoded; the bytes are used as the secret.
+func ParsePrivateKey(id string, keyType KeyType, der []byte) (Key, error) {
+	if keyType.Symmetric() {
+		return newSymmetricKey(id, keyType, der)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return Key{}, fmt.Errorf("parsing private key: %w", err)
+	}
+
+	switch priv := parsed.(type) {
+	case ed25519.PrivateKey:
+		if keyType != KeyTypeEd25519 {
+			return Key{}, fmt.Errorf("key type %q does not match Ed25519 private key", keyType)
+		}
+		return Key{ID: id, Type: keyType, Signer: priv}, nil
+	case *ecdsa.PrivateKey:
+		if keyType != KeyTypeES256 || priv.Curve != elliptic.P256() {
+			return Key{}, fmt.Errorf("key type %q does not match ECDSA private key", keyType)
+		}
+		return Key{ID: id, Type: keyType, Signer: priv}, nil
+	}
+	return Key{}, fmt.Errorf("unsupported private key %T", parsed)
+}
+
+// ParsePublicKey builds a verification-only key descriptor from PKIX DER bytes.
+// Symmetric keys have no public half; the bytes are used as the shared secret.
+func ParsePublicKey(id string, keyType KeyType, der []byte) (Key, error) {
+	if keyType.Symmetric() {
+		return newSymmetricKey(id, keyType, der)
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return Key{}, fmt.Errorf("parsing public key: %w", err)
+	}
+
+	switch pub := parsed.(type) {
+	case ed25519.PublicKey:
+		if keyType != KeyTypeEd25519 {
+			return Key{}, fmt.Errorf("key type %q does not match Ed25519 public key", keyType)
+		}
+	case *ecdsa.PublicKey:
+		if keyType != KeyTypeES256 || pub.Curve != elliptic.P256() {
+			return Key{}, fmt.Errorf("key type %q does not match ECDSA public key", keyType)
+		}
+	default:
+		return Key{}, fmt.Errorf("unsupported public key %T", parsed)
+	}
+	return Key{ID: id, Type: keyType, Public: parsed}, nil
+}
+
+// MarshalPrivateKey returns the private key as PKCS#8 DER bytes,
+// or the raw secret for symmetric keys.
+func (k Key) MarshalPrivateKey() ([]byte, error) {
+	if k.Type.Symmetric() {
+		return k.Secret, nil
+	}
+	if k.Signer == nil {
+		return nil, fmt.Errorf("key %q has no private key", k.ID)
+	}
+	return x509.MarshalPKCS8PrivateKey(k.Signer)
+}
+
+// PublicKey returns the key material a relay needs to validate tokens:
+// PKIX DER bytes for asymmetric keys, or the shared secret for symmetric keys.
+func (k Key) PublicKey() ([]byte, error) {
+	if k.Type.Symmetric() {
+		return k.Secret, nil
+	}
+	pub := k.publicKey()
+	if pub == nil {
+		return nil, fmt.Errorf("key %q has no public key", k.ID)
+	}
+	return x509.MarshalPKIXPublicKey(pub)
+}
+
+// macAlgorithm returns the key's HMAC algorithm, defaulting to HMAC 256/64.
+func (k Key) macAlgorithm() int64 {
+	if k.MACAlgorithm == 0 {
+		return AlgHMAC256Trunc64
+	}
+	return k.MACAlgorithm
+}
+
+// newSymmetricKey wraps a shared secret, checking the AES key size.
+func newSymmetricKey(id string, keyType KeyType, secret []byte) (Key, error) {
+	if keyType == KeyTypeA256GCM && len(secret) != 32 {
+		return Key{}, fmt.Errorf("A256GCM key must be 32 bytes, got %d", len(secret))
+	}
+	return Key{ID: id, Type: keyType, Secret: secret}, nil
+}
+
+// publicKey returns the public half of an asymmetric key, if known.
+func (k Key) publicKey() crypto.PublicKey {
+	if k.Public != nil {
+		return k.Public
+	}
+	if k.Signer != nil {
+		return k.Signer.Public()
+	}
+	return nil
+}
+
+// signatureAlgorithm maps asymmetric key types to their COSE algorithm.
+func (k Key) signatureAlgorithm() (cose.Algorithm, error) {
+	switch k.Type {
+	case KeyTypeEd25519:
+		return cose.AlgorithmEdDSA, nil
+	case KeyTypeES256:
+		return cose.AlgorithmES256, nil
+	}
+	return 0, fmt.Errorf("key type %q cannot sign", k.Type)
+}
@@ -0,0 +1,125 @@
+package cwt
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+func TestGenerateDocToken_Sign1(t *testing.T) {
+	tests := []struct {
+		keyType KeyType
+		alg     cose.Algorithm
+	}{
+		{KeyTypeEd25519, cose.AlgorithmEdDSA},
+		{KeyTypeES256, cose.AlgorithmES256},
+	}
+	for _, tt := range tests {
+		key, err := GenerateKey("sign-key", tt.keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := GenerateDocToken(key, testIssuer, "doc123", "user1", "https://relay.example.com", "full", 3600)
+		if err != nil {
+			t.Fatalf("%s: GenerateDocToken failed: %v", tt.keyType, err)
+		}
+
+		msg := decodeCOSESign1(t, token)
+
+		alg, err := msg.Headers.Protected.Algorithm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alg != tt.alg {
+			t.Errorf("%s: expected algorithm %v, got %v", tt.keyType, tt.alg, alg)
+		}
+		if kid, _ := msg.Headers.Protected[cose.HeaderLabelKeyID].([]byte); string(kid) != "sign-key" {
+			t.Errorf("%s: expected key_id %q, got %q", tt.keyType, "sign-key", string(kid))
+		}
+
+		// Relays only hold the public key, so verify with that alone.
+		pubDER, err := key.PublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := x509.ParsePKIXPublicKey(pubDER)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifier, err := cose.NewVerifier(tt.alg, pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := msg.Verify(nil, verifier); err != nil {
+			t.Errorf("%s: signature did not verify: %v", tt.keyType, err)
+		}
+	}
+}
+
+func TestParsePrivateKey_RoundTrip(t *testing.T) {
+	for _, keyType := range []KeyType{KeyTypeHMAC, KeyTypeEd25519, KeyTypeES256} {
+		key, err := GenerateKey("k1", keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := key.MarshalPrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParsePrivateKey("k1", keyType, der)
+		if err != nil {
+			t.Fatalf("%s: ParsePrivateKey failed: %v", keyType, err)
+		}
+
+		want, _ := key.PublicKey()
+		got, _ := parsed.PublicKey()
+		if string(want) != string(got) {
+			t.Errorf("%s: public key changed after round trip", keyType)
+		}
+	}
+}
+
+func TestParsePrivateKey_TypeMismatch(t *testing.T) {
+	key, err := GenerateKey("k1", KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := key.MarshalPrivateKey()
+	if _, err := ParsePrivateKey("k1", KeyTypeES256, der); err == nil {
+		t.Fatal("expected error parsing Ed25519 key as ES256")
+	}
+}
+
+func TestParseKeyType(t *testing.T) {
+	if kt, err := ParseKeyType(""); err != nil || kt != KeyTypeHMAC {
+		t.Errorf("expected empty key_type to default to hmac, got %q (%v)", kt, err)
+	}
+	if _, err := ParseKeyType("rsa"); err == nil {
+		t.Error("expected error for unsupported key type")
+	}
+}
+
+// decodeCOSESign1 unwraps CWT tag 61 and decodes the inner COSE_Sign1 message.
+func decodeCOSESign1(t *testing.T, token string) *cose.Sign1Message {
+	t.Helper()
+	raw, _ := base64.RawURLEncoding.DecodeString(token)
+
+	var cwtTag cbor.Tag
+	if err := cbor.Unmarshal(raw, &cwtTag); err != nil {
+		t.Fatalf("unmarshal CWT tag: %v", err)
+	}
+	if cwtTag.Number != 61 {
+		t.Fatalf("expected CWT tag 61, got %d", cwtTag.Number)
+	}
+
+	innerBytes, _ := cbor.Marshal(cwtTag.Content)
+	var msg cose.Sign1Message
+	if err := msg.UnmarshalCBOR(innerBytes); err != nil {
+		t.Fatalf("unmarshal COSE_Sign1: %v", err)
+	}
+	return &msg
+}
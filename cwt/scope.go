@@ -0,0 +1,149 @@
+package cwt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Scope is the parsed form of the private scope claim (-80201).
+//
+//	doc:<docId>[:<folderGuid>]:<perm>
+//	file:<fileHash>:<docId>[:<folderGuid>]:<perm>
+//	folder:<folderGuid>:<perm>
+//
+// Doc and file scopes name the shared folder the document was requested
+// through, if any, so relays can check the document belongs to it.
+//
+// The claim holds a single scope string, or an array of them when one token
+// covers several resources (e.g. a note and its embedded files).
+type Scope struct {
+	Kind       string // "doc", "file" or "folder"
+	DocID      string
+	FileHash   string // only set for file scopes
+	FolderID   string // required for folder scopes, optional for doc and file scopes
+	Permission string // "rw" or "r"
+}
+
+// DocScope returns the scope for a document token.
+// Authorization should be "full" (→ rw) or "read-only" (→ r).
+func DocScope(docId string, authorization string) Scope {
+	return Scope{Kind: "doc", DocID: docId, Permission: authSuffix(authorization)}
+}
+
+// FileScope returns the scope for a file token.
+// Authorization should be "full" (→ rw) or "read-only" (→ r).
+func FileScope(fileHash string, docId string, authorization string) Scope {
+	return Scope{Kind: "file", FileHash: fileHash, DocID: docId, Permission: authSuffix(authorization)}
+}
+
+// FolderScope returns the scope for a token covering every document in a
+// shared folder. Authorization should be "full" (→ rw) or "read-only" (→ r).
+func FolderScope(folderGuid string, authorization string) Scope {
+	return Scope{Kind: "folder", FolderID: folderGuid, Permission: authSuffix(authorization)}
+}
+
+// InFolder returns a copy of a doc or file scope limited to documents in the
+// shared folder folderGuid.
+func (s Scope) InFolder(folderGuid string) Scope {
+	s.FolderID = folderGuid
+	return s
+}
+
+// ParseScope parses and validates a scope claim string.
+func ParseScope(s string) (Scope, error) {
+	parts := strings.Split(s, ":")
+	var scope Scope
+	switch {
+	case len(parts) == 3 && parts[0] == "doc":
+		scope = Scope{Kind: "doc", DocID: parts[1], Permission: parts[2]}
+	case len(parts) == 4 && parts[0] == "doc":
+		scope = Scope{Kind: "doc", DocID: parts[1], FolderID: parts[2], Permission: parts[3]}
+	case len(parts) == 4 && parts[0] == "file":
+		scope = Scope{Kind: "file", FileHash: parts[1], DocID: parts[2], Permission: parts[3]}
+	case len(parts) == 5 && parts[0] == "file":
+		scope = Scope{Kind: "file", FileHash: parts[1], DocID: parts[2], FolderID: parts[3], Permission: parts[4]}
+	case len(parts) == 3 && parts[0] == "folder":
+		scope = Scope{Kind: "folder", FolderID: parts[1], Permission: parts[2]}
+	default:
+		return Scope{}, fmt.Errorf("malformed scope %q", s)
+	}
+
+	if err := scope.Validate(); err != nil {
+		return Scope{}, err
+	}
+	if scope.String() != s {
+		return Scope{}, fmt.Errorf("malformed scope %q", s) // e.g. an empty folder segment
+	}
+	return scope, nil
+}
+
+// Validate checks that the scope has a known kind and permission, and that
+// its IDs are set and free of the ':' separator.
+func (s Scope) Validate() error {
+	var ids []string
+	switch s.Kind {
+	case "doc":
+		ids = []string{s.DocID}
+	case "file":
+		ids = []string{s.FileHash, s.DocID}
+	case "folder":
+		ids = []string{s.FolderID}
+	default:
+		return fmt.Errorf("unknown scope kind %q", s.Kind)
+	}
+
+	for _, id := range ids {
+		if id == "" {
+			return fmt.Errorf("%s scope has an empty ID", s.Kind)
+		}
+	}
+	if s.Kind != "folder" && s.FolderID != "" {
+		ids = append(ids, s.FolderID)
+	}
+	for _, id := range ids {
+		if strings.Contains(id, ":") {
+			return fmt.Errorf("%s scope ID %q must not contain ':'", s.Kind, id)
+		}
+	}
+
+	if s.Permission != "rw" && s.Permission != "r" {
+		return fmt.Errorf("%s scope has unknown permission %q", s.Kind, s.Permission)
+	}
+	return nil
+}
+
+// String formats the scope in its claim representation.
+func (s Scope) String() string {
+	switch {
+	case s.Kind == "folder":
+		return fmt.Sprintf("folder:%s:%s", s.FolderID, s.Permission)
+	case s.Kind == "file" && s.FolderID != "":
+		return fmt.Sprintf("file:%s:%s:%s:%s", s.FileHash, s.DocID, s.FolderID, s.Permission)
+	case s.Kind == "file":
+		return fmt.Sprintf("file:%s:%s:%s", s.FileHash, s.DocID, s.Permission)
+	case s.FolderID != "":
+		return fmt.Sprintf("%s:%s:%s:%s", s.Kind, s.DocID, s.FolderID, s.Permission)
+	}
+	return fmt.Sprintf("%s:%s:%s", s.Kind, s.DocID, s.Permission)
+}
+
+// WithAuthorization returns a copy of the scope with its permission set from
+// authorization ("full" → rw, anything else → r).
+func (s Scope) WithAuthorization(authorization string) Scope {
+	s.Permission = authSuffix(authorization)
+	return s
+}
+
+// CanWrite reports whether the scope grants write access.
+func (s Scope) CanWrite() bool {
+	return s.Permission == "rw"
+}
+
+// FormatScopes joins scopes into a space-separated list.
+func FormatScopes(scopes []Scope) string {
+	parts := make([]string, len(scopes))
+	for i, s := range scopes {
+		parts[i] = s.String()
+	}
+	return strings.Join(parts, " ")
+}
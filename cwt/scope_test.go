@@ -0,0 +1,79 @@
+package cwt
+
+import "testing"
+
+func TestParseScope_RoundTrip(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Scope
+	}{
+		{"doc:doc123:rw", Scope{Kind: "doc", DocID: "doc123", Permission: "rw"}},
+		{"file:abc123:doc456:r", Scope{Kind: "file", FileHash: "abc123", DocID: "doc456", Permission: "r"}},
+		{"doc:doc123:f1e2d3:rw", Scope{Kind: "doc", DocID: "doc123", FolderID: "f1e2d3", Permission: "rw"}},
+		{"file:abc123:doc456:f1e2d3:r", Scope{Kind: "file", FileHash: "abc123", DocID: "doc456", FolderID: "f1e2d3", Permission: "r"}},
+		{"folder:f1e2d3:rw", Scope{Kind: "folder", FolderID: "f1e2d3", Permission: "rw"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseScope(tt.in)
+		if err != nil {
+			t.Fatalf("ParseScope(%q) failed: %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseScope(%q): expected %+v, got %+v", tt.in, tt.want, got)
+		}
+		if got.String() != tt.in {
+			t.Errorf("String(): expected %q, got %q", tt.in, got.String())
+		}
+	}
+}
+
+func TestParseScope_Invalid(t *testing.T) {
+	for _, in := range []string{"", "doc:doc123", "doc:doc123:w", "folder:a:b:rw", "vault:x:rw", "doc::rw", "file::doc1:r", "doc:doc1::rw", "file:abc:doc1::r", "file:a:b:c:d:e:r"} {
+		if _, err := ParseScope(in); err == nil {
+			t.Errorf("ParseScope(%q): expected error", in)
+		}
+	}
+}
+
+func TestFolderScope(t *testing.T) {
+	if got := FolderScope("f1", "read-only").String(); got != "folder:f1:r" {
+		t.Errorf("expected %q, got %q", "folder:f1:r", got)
+	}
+}
+
+func TestScopeValidate_RejectsColon(t *testing.T) {
+	for _, s := range []Scope{
+		DocScope("a:b", "full"),
+		FileScope("abc:123", "doc1", "full"),
+		FileScope("abc123", "doc:1", "full"),
+		FolderScope("f:1", "read-only"),
+		DocScope("doc1", "full").InFolder("f:1"),
+	} {
+		if err := s.Validate(); err == nil {
+			t.Errorf("Validate(%+v): expected error", s)
+		}
+	}
+}
+
+func TestScopeInFolder(t *testing.T) {
+	folder := "f1"
+	if got := DocScope("doc1", "full").InFolder(folder).String(); got != "doc:doc1:f1:rw" {
+		t.Errorf("expected %q, got %q", "doc:doc1:f1:rw", got)
+	}
+	if got := FileScope("abc", "doc1", "read-only").InFolder(folder).String(); got != "file:abc:doc1:f1:r" {
+		t.Errorf("expected %q, got %q", "file:abc:doc1:f1:r", got)
+	}
+}
+func TestFormatScopes(t *testing.T) {
+	got := FormatScopes([]Scope{DocScope("doc1", "full"), FileScope("abc", "doc1", "full")})
+	if want := "doc:doc1:rw file:abc:doc1:rw"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestScopeWithAuthorization(t *testing.T) {
+	s := FileScope("abc", "doc1", "full").WithAuthorization("read-only")
+	if got := s.String(); got != "file:abc:doc1:r" {
+		t.Errorf("expected %q, got %q", "file:abc:doc1:r", got)
+	}
+}
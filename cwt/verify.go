@@ -0,0 +1,371 @@
+package cwt
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+var (
+	ErrMalformed        = errors.New("cwt: malformed token")
+	ErrUnknownKey       = errors.New("cwt: unknown key id")
+	ErrInvalidMAC       = errors.New("cwt: invalid MAC")
+	ErrInvalidSignature = errors.New("cwt: invalid signature")
+	ErrDecryption       = errors.New("cwt: decryption failed")
+	ErrExpired          = errors.New("cwt: token expired")
+	ErrIssuedInFuture   = errors.New("cwt: token issued in the future")
+	ErrNotYetValid      = errors.New("cwt: token not yet valid")
+	ErrInvalidIssuer    = errors.New("cwt: invalid issuer")
+	ErrInvalidAudience  = errors.New("cwt: invalid audience")
+)
+
+const (
+	coseEncrypt0Tag = 16
+	coseMac0Tag     = 17
+	coseSign1Tag    = 18
+	cwtTag          = 61
+)
+
+// Claims holds the claims of a CWT. ID is the hex-encoded cti claim and is
+// omitted from the token when empty, as is NotBefore when zero.
+type Claims struct {
+	ID        string
+	Issuer    string
+	Subject   string
+	Audience  string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	Scopes    []Scope
+}
+
+// rawClaims mirrors the integer-keyed claims map written by buildClaimsMap.
+type rawClaims struct {
+	Issuer   string `cbor:"1,keyasint,omitempty"`
+	Subject  string `cbor:"2,keyasint,omitempty"`
+	Audience string `cbor:"3,keyasint,omitempty"`
+	Exp      int64  `cbor:"4,keyasint,omitempty"`
+	Nbf      int64  `cbor:"5,keyasint,omitempty"`
+	Iat      int64  `cbor:"6,keyasint,omitempty"`
+	Cti      []byte `cbor:"7,keyasint,omitempty"`
+	// Scope is either a single scope string or an array of them.
+	Scope cbor.RawMessage `cbor:"-80201,keyasint,omitempty"`
+}
+
+// Token is a decoded CWT. Its MAC or signature has not been checked unless
+// it was returned by Verify. Encrypted tokens have empty Claims until
+// VerifyKey decrypts them.
+type Token struct {
+	KeyID     string
+	Algorithm int64
+	Claims    Claims
+
+	coseTag   uint64 // coseMac0Tag, coseSign1Tag or coseEncrypt0Tag
+	message   []byte // tagged COSE message, as received
+	protected []byte
+	payload   []byte
+	tag       []byte // MAC tag, signature or ciphertext
+	iv        []byte // COSE_Encrypt0 only
+}
+
+// Keyring maps key IDs to the keys accepted when verifying tokens.
+type Keyring map[string]Key
+
+// NewKeyring builds a Keyring from the given keys.
+func NewKeyring(keys ...Key) Keyring {
+	kr := make(Keyring, len(keys))
+	for _, k := range keys {
+		kr[k.ID] = k
+	}
+	return kr
+}
+
+// VerifyOptions controls claim validation in Verify.
+type VerifyOptions struct {
+	Issuer   string        // expected iss; empty accepts any issuer
+	Audience string        // expected aud; empty accepts any audience
+	Leeway   time.Duration // allowed clock skew for exp, nbf and iat
+	Now      time.Time     // defaults to time.Now()
+}
+
+// Parse decodes a base64url CWT without checking its MAC or signature.
+// It accepts COSE_Mac0 (tag 17), COSE_Sign1 (tag 18) and COSE_Encrypt0
+// (tag 16) messages, with or without the outer CWT tag 61.
+func Parse(token string) (*Token, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(token, "="))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	var outer cbor.RawTag
+	if err := cbor.Unmarshal(raw, &outer); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	message := raw
+	inner := outer
+	if outer.Number == cwtTag {
+		message = outer.Content
+		if err := cbor.Unmarshal(message, &inner); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+	}
+	if inner.Number == coseEncrypt0Tag {
+		return parseEncrypt0(inner, message)
+	}
+	if inner.Number != coseMac0Tag && inner.Number != coseSign1Tag {
+		return nil, fmt.Errorf("%w: unexpected COSE tag %d", ErrMalformed, inner.Number)
+	}
+
+	// COSE_Mac0 and COSE_Sign1 share the same shape:
+	// [protected, unprotected, payload, tag/signature]
+	var arr []cbor.RawMessage
+	if err := cbor.Unmarshal(inner.Content, &arr); err != nil || len(arr) != 4 {
+		return nil, fmt.Errorf("%w: expected 4-element COSE array", ErrMalformed)
+	}
+
+	t := &Token{coseTag: inner.Number, message: message}
+	if err := cbor.Unmarshal(arr[0], &t.protected); err != nil {
+		return nil, fmt.Errorf("%w: protected headers: %v", ErrMalformed, err)
+	}
+	if err := cbor.Unmarshal(arr[2], &t.payload); err != nil {
+		return nil, fmt.Errorf("%w: payload: %v", ErrMalformed, err)
+	}
+	if err := cbor.Unmarshal(arr[3], &t.tag); err != nil {
+		return nil, fmt.Errorf("%w: tag: %v", ErrMalformed, err)
+	}
+
+	if err := t.decodeHeaders(arr[1]); err != nil {
+		return nil, err
+	}
+	if err := t.decodeClaims(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// parseEncrypt0 decodes the headers of a COSE_Encrypt0 message:
+// [protected, unprotected, ciphertext]. Claims stay encrypted.
+func parseEncrypt0(inner cbor.RawTag, message []byte) (*Token, error) {
+	var arr []cbor.RawMessage
+	if err := cbor.Unmarshal(inner.Content, &arr); err != nil || len(arr) != 3 {
+		return nil, fmt.Errorf("%w: expected 3-element COSE_Encrypt0 array", ErrMalformed)
+	}
+
+	t := &Token{coseTag: inner.Number, message: message}
+	if err := cbor.Unmarshal(arr[0], &t.protected); err != nil {
+		return nil, fmt.Errorf("%w: protected headers: %v", ErrMalformed, err)
+	}
+	if err := cbor.Unmarshal(arr[2], &t.tag); err != nil {
+		return nil, fmt.Errorf("%w: ciphertext: %v", ErrMalformed, err)
+	}
+	if err := t.decodeHeaders(arr[1]); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Verify parses a token, checks its MAC or signature (or decrypts it) with
+// the key in keys matching its kid, and validates exp, nbf, iat, iss and aud.
+func Verify(token string, keys Keyring, opts VerifyOptions) (*Claims, error) {
+	t, err := Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.VerifyKey(keys); err != nil {
+		return nil, err
+	}
+	if err := t.Claims.Validate(opts); err != nil {
+		return nil, err
+	}
+	return &t.Claims, nil
+}
+
+// VerifyKey checks the token's MAC or signature against the key in keys
+// matching its kid, or decrypts its claims. Claims are not validated.
+func (t *Token) VerifyKey(keys Keyring) error {
+	key, ok := keys[t.KeyID]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownKey, t.KeyID)
+	}
+
+	switch t.coseTag {
+	case coseMac0Tag:
+		return t.verifyMAC(key)
+	case coseSign1Tag:
+		return t.verifySignature(key)
+	case coseEncrypt0Tag:
+		return t.decrypt(key)
+	}
+	return ErrMalformed
+}
+
+// Validate checks the time-based and identity claims.
+func (c *Claims) Validate(opts VerifyOptions) error {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	if c.ExpiresAt.IsZero() || now.After(c.ExpiresAt.Add(opts.Leeway)) {
+		return ErrExpired
+	}
+	if !c.NotBefore.IsZero() && c.NotBefore.After(now.Add(opts.Leeway)) {
+		return ErrNotYetValid
+	}
+	if c.IssuedAt.After(now.Add(opts.Leeway)) {
+		return ErrIssuedInFuture
+	}
+	if opts.Issuer != "" && c.Issuer != opts.Issuer {
+		return ErrInvalidIssuer
+	}
+	if opts.Audience != "" && c.Audience != opts.Audience {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+func (t *Token) decodeHeaders(unprotectedRaw cbor.RawMessage) error {
+	var protected map[int64]cbor.RawMessage
+	if len(t.protected) > 0 {
+		if err := cbor.Unmarshal(t.protected, &protected); err != nil {
+			return fmt.Errorf("%w: protected headers: %v", ErrMalformed, err)
+		}
+	}
+	var unprotected map[int64]cbor.RawMessage
+	if err := cbor.Unmarshal(unprotectedRaw, &unprotected); err != nil {
+		return fmt.Errorf("%w: unprotected headers: %v", ErrMalformed, err)
+	}
+
+	algRaw, ok := protected[1]
+	if !ok {
+		return fmt.Errorf("%w: missing alg header", ErrMalformed)
+	}
+	if err := cbor.Unmarshal(algRaw, &t.Algorithm); err != nil {
+		return fmt.Errorf("%w: alg header: %v", ErrMalformed, err)
+	}
+
+	kidRaw, ok := protected[4]
+	if !ok {
+		kidRaw, ok = unprotected[4]
+	}
+	if ok {
+		var kid []byte
+		if err := cbor.Unmarshal(kidRaw, &kid); err != nil {
+			return fmt.Errorf("%w: kid header: %v", ErrMalformed, err)
+		}
+		t.KeyID = string(kid)
+	}
+
+	if ivRaw, ok := unprotected[5]; ok {
+		if err := cbor.Unmarshal(ivRaw, &t.iv); err != nil {
+			return fmt.Errorf("%w: iv header: %v", ErrMalformed, err)
+		}
+	}
+	return nil
+}
+
+func (t *Token) decodeClaims() error {
+	var rc rawClaims
+	if err := cbor.Unmarshal(t.payload, &rc); err != nil {
+		return fmt.Errorf("%w: claims: %v", ErrMalformed, err)
+	}
+
+	t.Claims = Claims{
+		ID:       hex.EncodeToString(rc.Cti),
+		Issuer:   rc.Issuer,
+		Subject:  rc.Subject,
+		Audience: rc.Audience,
+	}
+	if rc.Exp != 0 {
+		t.Claims.ExpiresAt = time.Unix(rc.Exp, 0)
+	}
+	if rc.Nbf != 0 {
+		t.Claims.NotBefore = time.Unix(rc.Nbf, 0)
+	}
+	if rc.Iat != 0 {
+		t.Claims.IssuedAt = time.Unix(rc.Iat, 0)
+	}
+	if len(rc.Scope) > 0 {
+		scopes, err := decodeScopes(rc.Scope)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		t.Claims.Scopes = scopes
+	}
+	return nil
+}
+
+// decodeScopes parses the scope claim, which is either a single string or an
+// array of strings.
+func decodeScopes(raw cbor.RawMessage) ([]Scope, error) {
+	var list []string
+	var single string
+	if err := cbor.Unmarshal(raw, &single); err == nil {
+		list = []string{single}
+	} else if err := cbor.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("scope claim: %v", err)
+	}
+
+	scopes := make([]Scope, 0, len(list))
+	for _, s := range list {
+		scope, err := ParseScope(s)
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+// verifyMAC checks the MAC tag. Tokens may use a stronger HMAC algorithm than
+// the key is configured for, but never a shorter tag, so a key set to
+// HMAC 256/256 rejects HMAC 256/64 tokens.
+func (t *Token) verifyMAC(key Key) error {
+	if key.Type != KeyTypeHMAC {
+		return ErrInvalidMAC
+	}
+	_, tagLen, err := macParams(t.Algorithm)
+	if err != nil {
+		return ErrInvalidMAC
+	}
+	_, minTagLen, err := macParams(key.macAlgorithm())
+	if err != nil || tagLen < minTagLen {
+		return ErrInvalidMAC
+	}
+	expected, err := computeMAC(t.Algorithm, t.protected, t.payload, key.Secret)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(expected, t.tag) {
+		return ErrInvalidMAC
+	}
+	return nil
+}
+
+func (t *Token) verifySignature(key Key) error {
+	alg, err := key.signatureAlgorithm()
+	if err != nil || int64(alg) != t.Algorithm {
+		return ErrInvalidSignature
+	}
+	verifier, err := cose.NewVerifier(alg, key.publicKey())
+	if err != nil {
+		return fmt.Errorf("creating verifier: %w", err)
+	}
+
+	var msg cose.Sign1Message
+	if err := msg.UnmarshalCBOR(t.message); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if err := msg.Verify(nil, verifier); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package cwt
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const testAudience = "https://relay.example.com"
+
+func TestVerify_HMAC(t *testing.T) {
+	token, err := GenerateFileToken(testKey, testIssuer, "doc456", "user1", testAudience, "full", 3600, "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := Verify(token, NewKeyring(testKey), VerifyOptions{Issuer: testIssuer, Audience: testAudience})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	if claims.Subject != "user1" {
+		t.Errorf("expected subject %q, got %q", "user1", claims.Subject)
+	}
+	want := Scope{Kind: "file", DocID: "doc456", FileHash: "abc123", Permission: "rw"}
+	if len(claims.Scopes) != 1 || claims.Scopes[0] != want {
+		t.Errorf("expected scopes [%+v], got %+v", want, claims.Scopes)
+	}
+	if d := time.Until(claims.ExpiresAt); d < 3590*time.Second || d > 3600*time.Second {
+		t.Errorf("unexpected expiry %v", claims.ExpiresAt)
+	}
+}
+
+func TestVerify_Sign1(t *testing.T) {
+	for _, keyType := range []KeyType{KeyTypeEd25519, KeyTypeES256} {
+		key, err := GenerateKey("sign-key", keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := GenerateDocToken(key, testIssuer, "doc123", "user1", testAudience, "read-only", 3600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Verify with the public half only, as a relay would.
+		pubDER, _ := key.PublicKey()
+		pub, err := ParsePublicKey("sign-key", keyType, pubDER)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		claims, err := Verify(token, NewKeyring(pub), VerifyOptions{})
+		if err != nil {
+			t.Fatalf("%s: Verify failed: %v", keyType, err)
+		}
+		if claims.Scopes[0].CanWrite() {
+			t.Errorf("%s: expected read-only scope, got %q", keyType, claims.Scopes[0])
+		}
+	}
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	token, err := GenerateDocToken(testKey, testIssuer, "doc123", "user1", testAudience, "full", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey := NewHMACKey(testKeyId, []byte("another_key_123456789012345678901"))
+	signKey, _ := GenerateKey(testKeyId, KeyTypeEd25519)
+
+	tests := []struct {
+		name string
+		keys Keyring
+		opts VerifyOptions
+		want error
+	}{
+		{"unknown kid", NewKeyring(NewHMACKey("other", testSecret)), VerifyOptions{}, ErrUnknownKey},
+		{"wrong secret", NewKeyring(otherKey), VerifyOptions{}, ErrInvalidMAC},
+		{"wrong key type", NewKeyring(signKey), VerifyOptions{}, ErrInvalidMAC},
+		{"expired", NewKeyring(testKey), VerifyOptions{Now: time.Now().Add(2 * time.Minute)}, ErrExpired},
+		{"issued in future", NewKeyring(testKey), VerifyOptions{Now: time.Now().Add(-time.Minute)}, ErrIssuedInFuture},
+		{"issuer", NewKeyring(testKey), VerifyOptions{Issuer: "someone-else"}, ErrInvalidIssuer},
+		{"audience", NewKeyring(testKey), VerifyOptions{Audience: "https://other.example.com"}, ErrInvalidAudience},
+	}
+	for _, tt := range tests {
+		_, err := Verify(token, tt.keys, tt.opts)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestVerify_Leeway(t *testing.T) {
+	token, err := GenerateDocToken(testKey, testIssuer, "doc123", "user1", testAudience, "full", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := VerifyOptions{Now: time.Now().Add(90 * time.Second), Leeway: time.Minute}
+	if _, err := Verify(token, NewKeyring(testKey), opts); err != nil {
+		t.Fatalf("expected token within leeway to verify, got %v", err)
+	}
+}
+
+func TestVerify_NotBefore(t *testing.T) {
+	now := time.Now()
+	token, err := Issue(testKey, Claims{
+		Audience:  testAudience,
+		IssuedAt:  now,
+		NotBefore: now.Add(time.Minute),
+		ExpiresAt: now.Add(time.Hour),
+		Scopes:    []Scope{DocScope("doc123", "full")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(token, NewKeyring(testKey), VerifyOptions{Now: now}); !errors.Is(err, ErrNotYetValid) {
+		t.Errorf("expected ErrNotYetValid, got %v", err)
+	}
+	claims, err := Verify(token, NewKeyring(testKey), VerifyOptions{Now: now, Leeway: 2 * time.Minute})
+	if err != nil {
+		t.Fatalf("expected token within leeway to verify, got %v", err)
+	}
+	if claims.NotBefore.Unix() != now.Add(time.Minute).Unix() {
+		t.Errorf("expected nbf %v, got %v", now.Add(time.Minute), claims.NotBefore)
+	}
+}
+
+func TestParse_Malformed(t *testing.T) {
+	for _, token := range []string{"", "not base64!", "oWFhAQ"} {
+		if _, err := Parse(token); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Parse(%q): expected ErrMalformed, got %v", token, err)
+		}
+	}
+}
+
+func TestParse_Headers(t *testing.T) {
+	token, err := GenerateDocToken(testKey, testIssuer, "doc123", "user1", testAudience, "full", 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := Parse(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.KeyID != testKeyId {
+		t.Errorf("expected kid %q, got %q", testKeyId, parsed.KeyID)
+	}
+	if parsed.Algorithm != 4 {
+		t.Errorf("expected alg 4, got %d", parsed.Algorithm)
+	}
+	if got := FormatScopes(parsed.Claims.Scopes); got != "doc:doc123:rw" {
+		t.Errorf("expected scope %q, got %q", "doc:doc123:rw", got)
+	}
+}
+
+func TestIssue_TokenID(t *testing.T) {
+	id, err := NewTokenID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := Issue(testKey, Claims{
+		ID:        id,
+		Subject:   "user1",
+		Audience:  testAudience,
+		ExpiresAt: time.Now().Add(time.Hour),
+		Scopes:    []Scope{DocScope("doc123", "full")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := Verify(token, NewKeyring(testKey), VerifyOptions{Issuer: DefaultIssuer})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if claims.ID != id {
+		t.Errorf("expected cti %q, got %q", id, claims.ID)
+	}
+}
+
+func TestIssue_InvalidTokenID(t *testing.T) {
+	_, err := Issue(testKey, Claims{
+		ID:        "not-hex",
+		ExpiresAt: time.Now().Add(time.Hour),
+		Scopes:    []Scope{DocScope("doc123", "full")},
+	})
+	if err == nil {
+		t.Fatal("expected error for non-hex token id")
+	}
+}
+
+func TestIssue_MultipleScopes(t *testing.T) {
+	scopes := []Scope{
+		DocScope("doc123", "full"),
+		FileScope("abc123", "doc123", "full"),
+		FileScope("def456", "doc123", "full"),
+	}
+	token, err := Issue(testKey, Claims{
+		Subject:   "user1",
+		Audience:  testAudience,
+		ExpiresAt: time.Now().Add(time.Hour),
+		Scopes:    scopes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := Verify(token, NewKeyring(testKey), VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(claims.Scopes) != len(scopes) {
+		t.Fatalf("expected %d scopes, got %+v", len(scopes), claims.Scopes)
+	}
+	for i := range scopes {
+		if claims.Scopes[i] != scopes[i] {
+			t.Errorf("scope %d: expected %+v, got %+v", i, scopes[i], claims.Scopes[i])
+		}
+	}
+}
+
+func TestIssue_InvalidScopes(t *testing.T) {
+	for name, scopes := range map[string][]Scope{
+		"none":        nil,
+		"colon in id": {DocScope("doc:123", "full")},
+		"empty id":    {FileScope("", "doc123", "full")},
+	} {
+		_, err := Issue(testKey, Claims{ExpiresAt: time.Now().Add(time.Hour), Scopes: scopes})
+		if err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestVerify_MACAlgorithms(t *testing.T) {
+	for alg, tagLen := range map[int64]int{
+		AlgHMAC256Trunc64: 8,
+		AlgHMAC256:        32,
+		AlgHMAC384:        48,
+		AlgHMAC512:        64,
+	} {
+		key := NewHMACKey(testKeyId, testSecret)
+		key.MACAlgorithm = alg
+		token, err := GenerateDocToken(key, testIssuer, "doc123", "user1", testAudience, "full", 3600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsed, err := Parse(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Algorithm != alg {
+			t.Errorf("alg %d: header has alg %d", alg, parsed.Algorithm)
+		}
+		if len(parsed.tag) != tagLen {
+			t.Errorf("alg %d: expected %d-byte tag, got %d", alg, tagLen, len(parsed.tag))
+		}
+		if _, err := Verify(token, NewKeyring(key), VerifyOptions{}); err != nil {
+			t.Errorf("alg %d: Verify failed: %v", alg, err)
+		}
+	}
+}
+
+func TestVerify_MACDowngrade(t *testing.T) {
+	token, err := GenerateDocToken(testKey, testIssuer, "doc123", "user1", testAudience, "full", 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strict := NewHMACKey(testKeyId, testSecret)
+	strict.MACAlgorithm = AlgHMAC256
+	if _, err := Verify(token, NewKeyring(strict), VerifyOptions{}); !errors.Is(err, ErrInvalidMAC) {
+		t.Errorf("expected 64-bit tag to be rejected by an HMAC 256/256 key, got %v", err)
+	}
+
+	strong := NewHMACKey(testKeyId, testSecret)
+	strong.MACAlgorithm = AlgHMAC512
+	token, err = GenerateDocToken(strong, testIssuer, "doc123", "user1", testAudience, "full", 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(token, NewKeyring(testKey), VerifyOptions{}); err != nil {
+		t.Errorf("expected default key to accept a stronger tag, got %v", err)
+	}
+}
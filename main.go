@@ -15,12 +15,30 @@ func main() {
 
 	routes.RegisterHooks(app)
 	routes.RegisterAuthHooks(app)
+	routes.RegisterTokenCommands(app)
 
 	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		if err := routes.BootstrapSigningKeys(se.App); err != nil {
+			return err
+		}
+
 		routes.RegisterTokenRoutes(se)
 		routes.RegisterFileTokenRoutes(se)
+		routes.RegisterFolderTokenRoutes(se)
+		routes.RegisterBatchTokenRoutes(se)
+		routes.RegisterTokenRefreshRoutes(se)
 		routes.RegisterInvitationRoutes(se)
+		routes.RegisterEmailInvitationRoutes(se)
+		routes.RegisterSeatRoutes(se)
+		routes.RegisterAccessRequestRoutes(se)
 		routes.RegisterRotateKeyRoutes(se)
+		routes.RegisterKeyringRoutes(se)
+		routes.RegisterRevocationRoutes(se)
+		routes.RegisterIntrospectRoutes(se)
+		routes.RegisterTokenPolicyRoutes(se)
+		routes.RegisterAPIKeyRoutes(se)
+		routes.RegisterMemberRoutes(se)
+		routes.RegisterOwnershipTransferRoutes(se)
 		routes.RegisterSelfHostRoutes(se)
 		routes.RegisterTemplateRoutes(se)
 		routes.RegisterUtilityRoutes(se)
@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(upAccessRequests, downAccessRequests, "relays_11_access_requests")
+}
+
+func upAccessRequests(app core.App) error {
+	if _, err := app.FindCollectionByNameOrId("access_requests"); err == nil {
+		return nil
+	}
+	usersCol, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		return err
+	}
+	rolesCol, err := app.FindCollectionByNameOrId("roles")
+	if err != nil {
+		return err
+	}
+	relaysCol, err := app.FindCollectionByNameOrId("relays")
+	if err != nil {
+		return err
+	}
+
+	col := core.NewBaseCollection("access_requests")
+
+	// Requesters see their own requests and relay owners see all requests
+	// for their relay. Requests are created and decided through
+	// /api/relays/{relay}/request-access and
+	// /api/relays/{relay}/access-requests.
+	rule := "@request.auth.id != '' && (user = @request.auth.id || (" + relayOwnerMatch + "))"
+	col.ListRule = types.Pointer(rule)
+	col.ViewRule = types.Pointer(rule)
+
+	col.Fields.Add(
+		&core.RelationField{Name: "relay", CollectionId: relaysCol.Id, MaxSelect: 1, Required: true, CascadeDelete: true},
+		&core.RelationField{Name: "user", CollectionId: usersCol.Id, MaxSelect: 1, Required: true, CascadeDelete: true},
+		&core.TextField{Name: "message", Max: 1000},
+		&core.SelectField{Name: "status", Values: []string{"pending", "approved", "denied"}, MaxSelect: 1, Required: true},
+		&core.RelationField{Name: "role", CollectionId: rolesCol.Id, MaxSelect: 1},
+		&core.RelationField{Name: "decided_by", CollectionId: usersCol.Id, MaxSelect: 1},
+		&core.DateField{Name: "decided_at"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+	)
+	col.AddIndex("idx_access_requests_relay_status", false, "relay, status", "")
+	col.AddIndex("idx_access_requests_user", false, "user", "")
+
+	return app.Save(col)
+}
+
+func downAccessRequests(app core.App) error {
+	col, err := app.FindCollectionByNameOrId("access_requests")
+	if err != nil {
+		return err
+	}
+	return app.Delete(col)
+}
@@ -0,0 +1,97 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(upAPIKeys, downAPIKeys, "relays_07_api_keys")
+}
+
+func upAPIKeys(app core.App) error {
+	usersCol, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		return err
+	}
+	rolesCol, err := app.FindCollectionByNameOrId("roles")
+	if err != nil {
+		return err
+	}
+	relaysCol, err := app.FindCollectionByNameOrId("relays")
+	if err != nil {
+		return err
+	}
+	foldersCol, err := app.FindCollectionByNameOrId("shared_folders")
+	if err != nil {
+		return err
+	}
+
+	apiKeysCol, err := createAPIKeysCollection(app, usersCol.Id, rolesCol.Id, relaysCol.Id, foldersCol.Id)
+	if err != nil {
+		return err
+	}
+
+	// Tokens minted with an API key are recorded against the key instead of a user.
+	issuedCol, err := app.FindCollectionByNameOrId("issued_tokens")
+	if err != nil {
+		return err
+	}
+	issuedCol.Fields.Add(&core.RelationField{Name: "api_key", CollectionId: apiKeysCol.Id, MaxSelect: 1})
+	issuedCol.AddIndex("idx_issued_tokens_api_key", false, "api_key", "")
+	return app.Save(issuedCol)
+}
+
+func downAPIKeys(app core.App) error {
+	issuedCol, err := app.FindCollectionByNameOrId("issued_tokens")
+	if err != nil {
+		return err
+	}
+	issuedCol.RemoveIndex("idx_issued_tokens_api_key")
+	issuedCol.Fields.RemoveByName("api_key")
+	if err := app.Save(issuedCol); err != nil {
+		return err
+	}
+
+	col, err := app.FindCollectionByNameOrId("api_keys")
+	if err != nil {
+		return err
+	}
+	return app.Delete(col)
+}
+
+// createAPIKeysCollection creates machine credentials scoped to one relay.
+// Only a SHA-256 hash of the secret is stored; the prefix identifies the key.
+// Keys are created and revoked through /api/relays/{relay}/api-keys, so the
+// collection API is read-only and limited to relay owners.
+func createAPIKeysCollection(app core.App, usersId, rolesId, relaysId, foldersId string) (*core.Collection, error) {
+	if col, err := app.FindCollectionByNameOrId("api_keys"); err == nil {
+		return col, nil
+	}
+
+	col := core.NewBaseCollection("api_keys")
+
+	col.ListRule = types.Pointer(relayOwnerRule)
+	col.ViewRule = types.Pointer(relayOwnerRule)
+
+	col.Fields.Add(
+		&core.TextField{Name: "name", Required: true},
+		&core.TextField{Name: "prefix", Required: true},
+		&core.TextField{Name: "secret_hash", Required: true, Hidden: true},
+		&core.RelationField{Name: "relay", CollectionId: relaysId, MaxSelect: 1, Required: true, CascadeDelete: true},
+		&core.RelationField{Name: "role", CollectionId: rolesId, MaxSelect: 1, Required: true},
+		&core.RelationField{Name: "folder", CollectionId: foldersId, MaxSelect: 1},
+		&core.RelationField{Name: "created_by", CollectionId: usersId, MaxSelect: 1},
+		&core.DateField{Name: "expires_at"},
+		&core.BoolField{Name: "revoked"},
+		&core.DateField{Name: "last_used_at"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+	)
+	col.AddIndex("idx_api_keys_prefix", true, "prefix", "")
+
+	if err := app.Save(col); err != nil {
+		return nil, err
+	}
+	return col, nil
+}
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(upInvitationEmails, downInvitationEmails, "relays_10_invitation_emails")
+}
+
+// upInvitationEmails binds invitations to an email address. Invitations with
+// an email can only be accepted by a user with that verified address; the
+// shared invite link leaves it empty.
+//
+// Invitations now carry invitee addresses, so only relay owners may list
+// them. Invitees see an invitation through GET /api/invitations/{key}.
+func upInvitationEmails(app core.App) error {
+	usersCol, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		return err
+	}
+	col, err := app.FindCollectionByNameOrId("relay_invitations")
+	if err != nil {
+		return err
+	}
+	col.Fields.Add(
+		&core.EmailField{Name: "email"},
+		&core.RelationField{Name: "invited_by", CollectionId: usersCol.Id, MaxSelect: 1},
+	)
+	col.AddIndex("idx_relay_invitations_email", false, "relay, email", "")
+
+	col.ListRule = types.Pointer(relayOwnerRule)
+	col.ViewRule = types.Pointer(relayOwnerRule)
+	return app.Save(col)
+}
+
+func downInvitationEmails(app core.App) error {
+	col, err := app.FindCollectionByNameOrId("relay_invitations")
+	if err != nil {
+		return err
+	}
+	col.ListRule = types.Pointer("@request.auth.id != ''")
+	col.ViewRule = types.Pointer("@request.auth.id != ''")
+	col.RemoveIndex("idx_relay_invitations_email")
+	col.Fields.RemoveByName("email")
+	col.Fields.RemoveByName("invited_by")
+	return app.Save(col)
+}
@@ -0,0 +1,86 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(upInvitationLimits, downInvitationLimits, "relays_09_invitation_limits")
+}
+
+// upInvitationLimits lets invitations expire and cap how often they can be
+// redeemed, and logs who joined through which invitation. Unset expires_at
+// and max_uses mean no limit.
+func upInvitationLimits(app core.App) error {
+	usersCol, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		return err
+	}
+	rolesCol, err := app.FindCollectionByNameOrId("roles")
+	if err != nil {
+		return err
+	}
+	relaysCol, err := app.FindCollectionByNameOrId("relays")
+	if err != nil {
+		return err
+	}
+	invitationsCol, err := app.FindCollectionByNameOrId("relay_invitations")
+	if err != nil {
+		return err
+	}
+
+	invitationsCol.Fields.Add(
+		&core.DateField{Name: "expires_at"},
+		&core.NumberField{Name: "max_uses", OnlyInt: true, Min: types.Pointer(0.0)},
+		&core.NumberField{Name: "use_count", OnlyInt: true, Min: types.Pointer(0.0)},
+	)
+	if err := app.Save(invitationsCol); err != nil {
+		return err
+	}
+
+	return createInvitationRedemptionsCollection(app, usersCol.Id, rolesCol.Id, relaysCol.Id, invitationsCol.Id)
+}
+
+func downInvitationLimits(app core.App) error {
+	if col, err := app.FindCollectionByNameOrId("invitation_redemptions"); err == nil {
+		if err := app.Delete(col); err != nil {
+			return err
+		}
+	}
+
+	col, err := app.FindCollectionByNameOrId("relay_invitations")
+	if err != nil {
+		return err
+	}
+	col.Fields.RemoveByName("expires_at")
+	col.Fields.RemoveByName("max_uses")
+	col.Fields.RemoveByName("use_count")
+	return app.Save(col)
+}
+
+// createInvitationRedemptionsCollection records each accepted invitation.
+// Entries outlive the invitation itself, so relay owners can still see how
+// members joined after an invite is deleted. Written by /api/accept-invitation only.
+func createInvitationRedemptionsCollection(app core.App, usersId, rolesId, relaysId, invitationsId string) error {
+	if _, err := app.FindCollectionByNameOrId("invitation_redemptions"); err == nil {
+		return nil
+	}
+
+	col := core.NewBaseCollection("invitation_redemptions")
+
+	col.ListRule = types.Pointer(relayOwnerRule)
+	col.ViewRule = types.Pointer(relayOwnerRule)
+
+	col.Fields.Add(
+		&core.RelationField{Name: "invitation", CollectionId: invitationsId, MaxSelect: 1},
+		&core.RelationField{Name: "relay", CollectionId: relaysId, MaxSelect: 1, Required: true, CascadeDelete: true},
+		&core.RelationField{Name: "user", CollectionId: usersId, MaxSelect: 1, Required: true},
+		&core.RelationField{Name: "role", CollectionId: rolesId, MaxSelect: 1, Required: true},
+		&core.AutodateField{Name: "created", OnCreate: true},
+	)
+	col.AddIndex("idx_invitation_redemptions_relay", false, "relay", "")
+
+	return app.Save(col)
+}
@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Migrations are applied in name order. Those after "relays" carry a
+// two-digit sequence number so they run in the order they were added; new
+// migrations continue the sequence.
+func init() {
+	m.Register(upKeyring, downKeyring, "relays_01_keyring")
+}
+
+func upKeyring(app core.App) error {
+	return createSigningKeysCollection(app)
+}
+
+func downKeyring(app core.App) error {
+	col, err := app.FindCollectionByNameOrId("signing_keys")
+	if err != nil {
+		return err
+	}
+	return app.Delete(col)
+}
+
+// createSigningKeysCollection creates the token signing keyring.
+// The collection has no API rules, so only superusers can access it.
+func createSigningKeysCollection(app core.App) error {
+	if _, err := app.FindCollectionByNameOrId("signing_keys"); err == nil {
+		return nil
+	}
+
+	col := core.NewBaseCollection("signing_keys")
+
+	col.Fields.Add(
+		&core.TextField{Name: "key_id", Required: true},
+		&core.TextField{Name: "key_type", Required: true},
+		&core.TextField{Name: "private_key", Required: true, Hidden: true},
+		&core.TextField{Name: "public_key"},
+		&core.SelectField{Name: "status", Values: []string{"staged", "active", "retired"}, MaxSelect: 1, Required: true},
+		&core.DateField{Name: "valid_from"},
+		&core.DateField{Name: "valid_until"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+	)
+	col.AddIndex("idx_signing_keys_key_id", true, "key_id", "")
+
+	return app.Save(col)
+}
@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(upMACAlg, downMACAlg, "relays_06_mac_alg")
+}
+
+// upMACAlg adds the COSE HMAC algorithm (4-7) a provider's relays accept.
+// Unset keeps HMAC 256/64 for relays that predate longer tags.
+func upMACAlg(app core.App) error {
+	col, err := app.FindCollectionByNameOrId("providers")
+	if err != nil {
+		return err
+	}
+	col.Fields.Add(&core.NumberField{
+		Name:    "mac_alg",
+		OnlyInt: true,
+		Min:     types.Pointer(4.0),
+		Max:     types.Pointer(7.0),
+	})
+	return app.Save(col)
+}
+
+func downMACAlg(app core.App) error {
+	col, err := app.FindCollectionByNameOrId("providers")
+	if err != nil {
+		return err
+	}
+	col.Fields.RemoveByName("mac_alg")
+	return app.Save(col)
+}
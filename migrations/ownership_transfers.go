@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(upOwnershipTransfers, downOwnershipTransfers, "relays_08_ownership_transfers")
+}
+
+func upOwnershipTransfers(app core.App) error {
+	if _, err := app.FindCollectionByNameOrId("ownership_transfers"); err == nil {
+		return nil
+	}
+	usersCol, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		return err
+	}
+	relaysCol, err := app.FindCollectionByNameOrId("relays")
+	if err != nil {
+		return err
+	}
+
+	col := core.NewBaseCollection("ownership_transfers")
+
+	// Both sides can see a pending transfer; it is created, accepted and
+	// cancelled through /api/relays/{relay}/transfer.
+	rule := "@request.auth.id != '' && (from = @request.auth.id || to = @request.auth.id) && expires_at > @now"
+	col.ListRule = types.Pointer(rule)
+	col.ViewRule = types.Pointer(rule)
+
+	col.Fields.Add(
+		&core.RelationField{Name: "relay", CollectionId: relaysCol.Id, MaxSelect: 1, Required: true, CascadeDelete: true},
+		&core.RelationField{Name: "from", CollectionId: usersCol.Id, MaxSelect: 1, Required: true},
+		&core.RelationField{Name: "to", CollectionId: usersCol.Id, MaxSelect: 1, Required: true},
+		&core.DateField{Name: "expires_at", Required: true},
+		&core.AutodateField{Name: "created", OnCreate: true},
+	)
+	// At most one pending transfer per relay.
+	col.AddIndex("idx_ownership_transfers_relay", true, "relay", "")
+
+	return app.Save(col)
+}
+
+func downOwnershipTransfers(app core.App) error {
+	col, err := app.FindCollectionByNameOrId("ownership_transfers")
+	if err != nil {
+		return err
+	}
+	return app.Delete(col)
+}
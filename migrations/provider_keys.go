@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(upProviderKeys, downProviderKeys, "relays_02_provider_keys")
+}
+
+// upProviderKeys adds a hidden private_key field so self-hosted providers
+// can sign with Ed25519/ES256 keys while only exposing the public half.
+func upProviderKeys(app core.App) error {
+	col, err := app.FindCollectionByNameOrId("providers")
+	if err != nil {
+		return err
+	}
+	col.Fields.Add(&core.TextField{Name: "private_key", Hidden: true})
+	return app.Save(col)
+}
+
+func downProviderKeys(app core.App) error {
+	col, err := app.FindCollectionByNameOrId("providers")
+	if err != nil {
+		return err
+	}
+	col.Fields.RemoveByName("private_key")
+	return app.Save(col)
+}
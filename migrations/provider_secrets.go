@@ -0,0 +1,77 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(upProviderSecrets, downProviderSecrets, "relays_13_provider_secrets")
+}
+
+// symmetricKeyTypes are the key types whose public_key used to hold the
+// shared secret.
+var symmetricKeyTypes = dbx.In("key_type", "hmac", "a256gcm")
+
+// upProviderSecrets moves symmetric secrets out of public_key, which any
+// signed-in user can read on providers, into the hidden private_key field.
+// Default providers sign with the keyring, so their copy is just dropped.
+func upProviderSecrets(app core.App) error {
+	providers, err := app.FindAllRecords("providers", symmetricKeyTypes)
+	if err != nil {
+		return err
+	}
+	for _, p := range providers {
+		if p.GetBool("self_hosted") && p.GetString("private_key") == "" {
+			p.Set("private_key", p.GetString("public_key"))
+		}
+		p.Set("public_key", "")
+		if err := app.Save(p); err != nil {
+			return err
+		}
+	}
+
+	keys, err := app.FindAllRecords("signing_keys", symmetricKeyTypes)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		k.Set("public_key", "")
+		if err := app.Save(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func downProviderSecrets(app core.App) error {
+	keys, err := app.FindAllRecords("signing_keys", symmetricKeyTypes)
+	if err != nil {
+		return err
+	}
+	secrets := make(map[string]string, len(keys))
+	for _, k := range keys {
+		k.Set("public_key", k.GetString("private_key"))
+		if err := app.Save(k); err != nil {
+			return err
+		}
+		secrets[k.GetString("key_id")] = k.GetString("private_key")
+	}
+
+	providers, err := app.FindAllRecords("providers", symmetricKeyTypes)
+	if err != nil {
+		return err
+	}
+	for _, p := range providers {
+		if p.GetBool("self_hosted") {
+			p.Set("public_key", p.GetString("private_key"))
+		} else {
+			p.Set("public_key", secrets[p.GetString("key_id")])
+		}
+		if err := app.Save(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
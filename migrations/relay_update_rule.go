@@ -0,0 +1,21 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(upRelayUpdateRule, downRelayUpdateRule, "relays_14_relay_update_rule")
+}
+
+// upRelayUpdateRule limits relay updates to members whose role grants
+// manage_members. Fields tied to ownership, hosting and billing are further
+// reserved for superusers by the relays update hook.
+func upRelayUpdateRule(app core.App) error {
+	return setCollectionRules(app, "relays", []string{"update"}, relayCapabilityRule("id", "manage_members"))
+}
+
+func downRelayUpdateRule(app core.App) error {
+	return setCollectionRules(app, "relays", []string{"update"}, relayMemberRule)
+}
@@ -10,6 +10,14 @@ func init() {
 	m.Register(upRelays, downRelays, "relays")
 }
 
+// relayOwnerMatch matches when the caller owns the relay in the record's
+// relay field. It is one aliased relay_roles join, so the user and the Owner
+// role must match on the same membership row.
+const relayOwnerMatch = "@collection.relay_roles:owner.relay ?= relay && @collection.relay_roles:owner.user ?= @request.auth.id && @collection.relay_roles:owner.role ?= '2arnubkcv7jpce8'"
+
+// relayOwnerRule limits a relay-scoped collection to the relay's owners.
+const relayOwnerRule = "@request.auth.id != '' && " + relayOwnerMatch
+
 func upRelays(app core.App) error {
 	usersCol, err := app.FindCollectionByNameOrId("users")
 	if err != nil {
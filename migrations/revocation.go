@@ -0,0 +1,77 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(upRevocation, downRevocation, "relays_03_revocation")
+}
+
+func upRevocation(app core.App) error {
+	usersCol, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		return err
+	}
+	relaysCol, err := app.FindCollectionByNameOrId("relays")
+	if err != nil {
+		return err
+	}
+	providersCol, err := app.FindCollectionByNameOrId("providers")
+	if err != nil {
+		return err
+	}
+
+	if err := createIssuedTokensCollection(app, usersCol.Id, relaysCol.Id, providersCol.Id); err != nil {
+		return err
+	}
+
+	// Relays authenticate to the revocation feed with their provider id + api_secret.
+	providersCol.Fields.Add(&core.TextField{Name: "api_secret", Hidden: true})
+	return app.Save(providersCol)
+}
+
+func downRevocation(app core.App) error {
+	providersCol, err := app.FindCollectionByNameOrId("providers")
+	if err != nil {
+		return err
+	}
+	providersCol.Fields.RemoveByName("api_secret")
+	if err := app.Save(providersCol); err != nil {
+		return err
+	}
+
+	col, err := app.FindCollectionByNameOrId("issued_tokens")
+	if err != nil {
+		return err
+	}
+	return app.Delete(col)
+}
+
+// createIssuedTokensCollection creates the ledger of issued CWTs keyed by cti.
+// Relations are optional so ledger entries outlive deleted users and relays.
+func createIssuedTokensCollection(app core.App, usersId, relaysId, providersId string) error {
+	if _, err := app.FindCollectionByNameOrId("issued_tokens"); err == nil {
+		return nil
+	}
+
+	col := core.NewBaseCollection("issued_tokens")
+
+	col.Fields.Add(
+		&core.TextField{Name: "jti", Required: true},
+		&core.RelationField{Name: "user", CollectionId: usersId, MaxSelect: 1},
+		&core.RelationField{Name: "relay", CollectionId: relaysId, MaxSelect: 1},
+		&core.RelationField{Name: "provider", CollectionId: providersId, MaxSelect: 1},
+		&core.TextField{Name: "scope"},
+		&core.DateField{Name: "expires_at", Required: true},
+		&core.BoolField{Name: "revoked"},
+		&core.DateField{Name: "revoked_at"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+	)
+	col.AddIndex("idx_issued_tokens_jti", true, "jti", "")
+	col.AddIndex("idx_issued_tokens_user_relay", false, "user, relay", "")
+	col.AddIndex("idx_issued_tokens_provider_revoked", false, "provider, revoked", "")
+
+	return app.Save(col)
+}
@@ -0,0 +1,156 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(upRoleCapabilities, downRoleCapabilities, "relays_12_role_capabilities")
+}
+
+// roleCapabilities are what a role can grant. Routes and collection rules
+// check these instead of role IDs.
+var roleCapabilities = []string{
+	"issue_rw_token",
+	"manage_members",
+	"manage_invites",
+	"delete_relay",
+	"manage_folders",
+}
+
+// seededRoles are the built-in roles. Member predates capabilities and keeps
+// Editor's capabilities for existing memberships, invitations and API keys.
+var seededRoles = []struct {
+	id           string
+	name         string
+	capabilities []string
+}{
+	{"2arnubkcv7jpce8", "Owner", roleCapabilities},
+	{"tn3t166tg9k52oh", "Admin", []string{"issue_rw_token", "manage_members", "manage_invites", "manage_folders"}},
+	{"s6aduiulxjgrmz3", "Editor", []string{"issue_rw_token", "manage_folders"}},
+	{"gcsi1dmwuhzhbjk", "Viewer", []string{}},
+	{"x6lllh2qsf9lxk6", "Member", []string{"issue_rw_token", "manage_folders"}},
+}
+
+const (
+	invitationsRule    = "@request.auth.id != '' && relay.relay_roles_via_relay.user ?= @request.auth.id && relay.relay_roles_via_relay.role ?= '2arnubkcv7jpce8'"
+	relayMemberRule    = "@request.auth.id != '' && relay_roles_via_relay.user ?= @request.auth.id"
+	folderMemberRule   = "@request.auth.id != '' && relay.relay_roles_via_relay.user ?= @request.auth.id"
+	accessRequestsRule = "@request.auth.id != '' && (user = @request.auth.id || (" + relayOwnerMatch + "))"
+)
+
+// capabilityRules are the collection rules that check a capability, along
+// with the rules they replace.
+var capabilityRules = []struct {
+	collection string
+	rules      []string
+	rule       string
+	previous   string
+}{
+	{"relays", []string{"delete"}, relayCapabilityRule("id", "delete_relay"), relayMemberRule},
+	{"shared_folders", []string{"create", "update", "delete"}, relayCapabilityRule("relay", "manage_folders"), folderMemberRule},
+	{"relay_invitations", []string{"list", "view"}, relayCapabilityRule("relay", "manage_invites"), relayOwnerRule},
+	{"relay_invitations", []string{"create", "update", "delete"}, relayCapabilityRule("relay", "manage_invites"), invitationsRule},
+	{"invitation_redemptions", []string{"list", "view"}, relayCapabilityRule("relay", "manage_invites"), relayOwnerRule},
+	{"api_keys", []string{"list", "view"}, relayCapabilityRule("relay", "manage_members"), relayOwnerRule},
+	{
+		"access_requests", []string{"list", "view"},
+		"@request.auth.id != '' && (user = @request.auth.id || (" + relayCapabilityRule("relay", "manage_members") + "))",
+		accessRequestsRule,
+	},
+}
+
+// relayCapabilityRule matches when the caller's own relay_roles entry for the
+// relay in relayField has a role granting capability.
+func relayCapabilityRule(relayField string, capability string) string {
+	return fmt.Sprintf(
+		"@request.auth.id != '' && @collection.relay_roles:cap.relay ?= %s && @collection.relay_roles:cap.user ?= @request.auth.id && @collection.relay_roles:cap.role.capabilities ?~ '%s'",
+		relayField, capability,
+	)
+}
+
+func upRoleCapabilities(app core.App) error {
+	rolesCol, err := app.FindCollectionByNameOrId("roles")
+	if err != nil {
+		return err
+	}
+	rolesCol.Fields.Add(&core.SelectField{
+		Name:      "capabilities",
+		Values:    roleCapabilities,
+		MaxSelect: len(roleCapabilities),
+	})
+	if err := app.Save(rolesCol); err != nil {
+		return err
+	}
+
+	for _, seed := range seededRoles {
+		role, err := app.FindRecordById(rolesCol, seed.id)
+		if err != nil {
+			role = core.NewRecord(rolesCol)
+			role.Set("id", seed.id)
+			role.Set("name", seed.name)
+		}
+		role.Set("capabilities", seed.capabilities)
+		if err := app.Save(role); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range capabilityRules {
+		if err := setCollectionRules(app, r.collection, r.rules, r.rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func downRoleCapabilities(app core.App) error {
+	for _, r := range capabilityRules {
+		if err := setCollectionRules(app, r.collection, r.rules, r.previous); err != nil {
+			return err
+		}
+	}
+
+	rolesCol, err := app.FindCollectionByNameOrId("roles")
+	if err != nil {
+		return err
+	}
+	for _, seed := range seededRoles {
+		if seed.name == "Owner" || seed.name == "Member" {
+			continue
+		}
+		if role, err := app.FindRecordById(rolesCol, seed.id); err == nil {
+			if err := app.Delete(role); err != nil {
+				return err
+			}
+		}
+	}
+	rolesCol.Fields.RemoveByName("capabilities")
+	return app.Save(rolesCol)
+}
+
+func setCollectionRules(app core.App, collection string, rules []string, rule string) error {
+	col, err := app.FindCollectionByNameOrId(collection)
+	if err != nil {
+		return err
+	}
+	for _, name := range rules {
+		switch name {
+		case "list":
+			col.ListRule = types.Pointer(rule)
+		case "view":
+			col.ViewRule = types.Pointer(rule)
+		case "create":
+			col.CreateRule = types.Pointer(rule)
+		case "update":
+			col.UpdateRule = types.Pointer(rule)
+		case "delete":
+			col.DeleteRule = types.Pointer(rule)
+		}
+	}
+	return app.Save(col)
+}
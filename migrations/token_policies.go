@@ -0,0 +1,64 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(upTokenPolicies, downTokenPolicies, "relays_04_token_policies")
+}
+
+// Token lifetime bounds, in seconds. Unset (zero) TTLs fall back to defaults.
+// The token policy route validates against the same bounds.
+const (
+	MinTokenTTL = 60
+	MaxTokenTTL = 24 * 60 * 60
+)
+
+func upTokenPolicies(app core.App) error {
+	if _, err := app.FindCollectionByNameOrId("token_policies"); err == nil {
+		return nil
+	}
+	relaysCol, err := app.FindCollectionByNameOrId("relays")
+	if err != nil {
+		return err
+	}
+
+	col := core.NewBaseCollection("token_policies")
+
+	// Members can read their relay's policy; changes go through
+	// PUT /api/relays/{relay}/token-policy, which is restricted to owners.
+	rule := "@request.auth.id != '' && relay.relay_roles_via_relay.user ?= @request.auth.id"
+	col.ListRule = types.Pointer(rule)
+	col.ViewRule = types.Pointer(rule)
+
+	col.Fields.Add(
+		&core.RelationField{Name: "relay", CollectionId: relaysCol.Id, MaxSelect: 1, Required: true, CascadeDelete: true},
+		ttlField("doc_ttl"),
+		ttlField("file_ttl"),
+		ttlField("read_only_ttl"),
+		&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+	)
+	col.AddIndex("idx_token_policies_relay", true, "relay", "")
+
+	return app.Save(col)
+}
+
+func downTokenPolicies(app core.App) error {
+	col, err := app.FindCollectionByNameOrId("token_policies")
+	if err != nil {
+		return err
+	}
+	return app.Delete(col)
+}
+
+func ttlField(name string) *core.NumberField {
+	return &core.NumberField{
+		Name:    name,
+		OnlyInt: true,
+		Min:     types.Pointer(float64(MinTokenTTL)),
+		Max:     types.Pointer(float64(MaxTokenTTL)),
+	}
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(upTokenRefresh, downTokenRefresh, "relays_05_token_refresh")
+}
+
+// upTokenRefresh records the shared folder a token was issued through, so
+// refreshes can re-check folder membership.
+func upTokenRefresh(app core.App) error {
+	foldersCol, err := app.FindCollectionByNameOrId("shared_folders")
+	if err != nil {
+		return err
+	}
+	col, err := app.FindCollectionByNameOrId("issued_tokens")
+	if err != nil {
+		return err
+	}
+	col.Fields.Add(&core.RelationField{Name: "folder", CollectionId: foldersCol.Id, MaxSelect: 1})
+	return app.Save(col)
+}
+
+func downTokenRefresh(app core.App) error {
+	col, err := app.FindCollectionByNameOrId("issued_tokens")
+	if err != nil {
+		return err
+	}
+	col.Fields.RemoveByName("folder")
+	return app.Save(col)
+}
@@ -0,0 +1,261 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+	"net/mail"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	accessRequestPending  = "pending"
+	accessRequestApproved = "approved"
+	accessRequestDenied   = "denied"
+)
+
+var errAlreadyMember = errors.New("user is already a member of the relay")
+
+func RegisterAccessRequestRoutes(se *core.ServeEvent) {
+	se.Router.POST("/api/relays/{relay}/request-access", handleRequestAccess).
+		Bind(apis.RequireAuth()).
+		BindFunc(requireRateLimit(se.App, accessRequestRateLimits, nil))
+
+	g := se.Router.Group("/api/relays/{relay}/access-requests")
+	g.Bind(apis.RequireAuth())
+	g.GET("", handleListAccessRequests)
+	g.POST("/{id}/approve", handleApproveAccessRequest)
+	g.POST("/{id}/deny", handleDenyAccessRequest)
+}
+
+// handleRequestAccess lets a user who knows a relay's guid ask to be let in.
+// Members who can manage members are notified by email.
+func handleRequestAccess(e *core.RequestEvent) error {
+	relay, err := findRelay(e.App, e.Request.PathValue("relay"))
+	if err != nil {
+		return e.NotFoundError("Relay not found", nil)
+	}
+
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid request body", nil)
+	}
+
+	if _, err := findMembership(e.App, relay.Id, e.Auth.Id); err == nil {
+		return e.Error(409, "Already a member of this relay", nil)
+	}
+	_, err = e.App.FindFirstRecordByFilter(
+		"access_requests",
+		"relay = {:relay} && user = {:user} && status = {:status}",
+		dbx.Params{"relay": relay.Id, "user": e.Auth.Id, "status": accessRequestPending},
+	)
+	if err == nil {
+		return e.Error(409, "An access request for this relay is already pending", nil)
+	}
+
+	col, err := e.App.FindCollectionByNameOrId("access_requests")
+	if err != nil {
+		return e.InternalServerError("Collection not found", nil)
+	}
+	request := core.NewRecord(col)
+	request.Set("relay", relay.Id)
+	request.Set("user", e.Auth.Id)
+	request.Set("message", body.Message)
+	request.Set("status", accessRequestPending)
+	if err := e.App.Save(request); err != nil {
+		return e.BadRequestError("Failed to create access request", nil)
+	}
+
+	notifyManagersOfAccessRequest(e, relay, request)
+
+	return e.JSON(200, accessRequestResponse(e.App, request))
+}
+
+// handleListAccessRequests lists a relay's pending access requests.
+func handleListAccessRequests(e *core.RequestEvent) error {
+	relay, err := relayWithCapability(e, capManageMembers, "Not allowed to view access requests for this relay")
+	if err != nil {
+		return err
+	}
+
+	requests, err := e.App.FindRecordsByFilter(
+		"access_requests",
+		"relay = {:relay} && status = {:status}",
+		"created", 0, 0,
+		dbx.Params{"relay": relay.Id, "status": accessRequestPending},
+	)
+	if err != nil {
+		return e.InternalServerError("Failed to load access requests", nil)
+	}
+
+	items := make([]map[string]any, 0, len(requests))
+	for _, request := range requests {
+		items = append(items, accessRequestResponse(e.App, request))
+	}
+	return e.JSON(200, map[string]any{"items": items})
+}
+
+// handleApproveAccessRequest adds the requester to the relay with the chosen
+// role (Member by default).
+func handleApproveAccessRequest(e *core.RequestEvent) error {
+	relay, err := relayWithCapability(e, capManageMembers, "Not allowed to approve access requests for this relay")
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid request body", nil)
+	}
+	if body.Role == "" {
+		body.Role = memberRoleID
+	}
+	if _, err := e.App.FindRecordById("roles", body.Role); err != nil {
+		return e.BadRequestError("Unknown role", nil)
+	}
+	if !canGrantRole(e.App, e.Auth.Id, relay.Id, body.Role) {
+		return roleNotGrantableError(e)
+	}
+
+	var request *core.Record
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		request, err = findPendingAccessRequest(txApp, relay.Id, e.Request.PathValue("id"))
+		if err != nil {
+			return err
+		}
+		userID := request.GetString("user")
+		if _, err := findMembership(txApp, relay.Id, userID); err == nil {
+			return errAlreadyMember
+		}
+		if err := ensureSeatAvailable(txApp, relay, body.Role); err != nil {
+			return err
+		}
+
+		relayRolesCol, err := txApp.FindCollectionByNameOrId("relay_roles")
+		if err != nil {
+			return err
+		}
+		membership := core.NewRecord(relayRolesCol)
+		membership.Set("user", userID)
+		membership.Set("role", body.Role)
+		membership.Set("relay", relay.Id)
+		if err := txApp.Save(membership); err != nil {
+			return err
+		}
+
+		request.Set("role", body.Role)
+		return decideAccessRequest(txApp, request, accessRequestApproved, e.Auth.Id)
+	})
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return e.NotFoundError("Access request not found", nil)
+	case errors.Is(err, errAlreadyMember):
+		return e.Error(409, "Already a member of this relay", nil)
+	case errors.Is(err, errNoSeats):
+		return seatLimitError(e)
+	case err != nil:
+		return e.InternalServerError("Failed to approve access request", nil)
+	}
+
+	return e.JSON(200, accessRequestResponse(e.App, request))
+}
+
+// handleDenyAccessRequest rejects a pending access request. The requester
+// can ask again later.
+func handleDenyAccessRequest(e *core.RequestEvent) error {
+	relay, err := relayWithCapability(e, capManageMembers, "Not allowed to deny access requests for this relay")
+	if err != nil {
+		return err
+	}
+
+	request, err := findPendingAccessRequest(e.App, relay.Id, e.Request.PathValue("id"))
+	if err != nil {
+		return e.NotFoundError("Access request not found", nil)
+	}
+	if err := decideAccessRequest(e.App, request, accessRequestDenied, e.Auth.Id); err != nil {
+		return e.InternalServerError("Failed to deny access request", nil)
+	}
+
+	return e.JSON(200, accessRequestResponse(e.App, request))
+}
+
+func findPendingAccessRequest(app core.App, relayID string, id string) (*core.Record, error) {
+	return app.FindFirstRecordByFilter(
+		"access_requests",
+		"id = {:id} && relay = {:relay} && status = {:status}",
+		dbx.Params{"id": id, "relay": relayID, "status": accessRequestPending},
+	)
+}
+
+func decideAccessRequest(app core.App, request *core.Record, status string, deciderID string) error {
+	request.Set("status", status)
+	request.Set("decided_by", deciderID)
+	request.Set("decided_at", types.NowDateTime())
+	return app.Save(request)
+}
+
+// notifyManagersOfAccessRequest emails every member of the relay whose role
+// grants manage_members about a new access request. Failures are logged; the
+// request stays listable.
+func notifyManagersOfAccessRequest(e *core.RequestEvent, relay *core.Record, request *core.Record) {
+	managers, err := relayMembersWithCapability(e.App, relay.Id, capManageMembers)
+	if err != nil {
+		e.App.Logger().Error("Failed to load relay managers", "relay", relay.Id, "error", err)
+		return
+	}
+
+	requester := e.Auth.GetString("name")
+	if requester == "" {
+		requester = e.Auth.Email()
+	}
+
+	for _, manager := range managers {
+		user, err := e.App.FindRecordById("users", manager.GetString("user"))
+		if err != nil || user.Email() == "" {
+			continue
+		}
+		err = sendTemplatedEmail(
+			e.App,
+			"templates/access_request_email.html.tmpl",
+			mail.Address{Address: user.Email()},
+			requester+" requested access to "+relay.GetString("name"),
+			map[string]any{
+				"Requester":      requester,
+				"RequesterEmail": e.Auth.Email(),
+				"Relay":          relay.GetString("name"),
+				"Message":        request.GetString("message"),
+			},
+		)
+		if err != nil {
+			e.App.Logger().Error("Failed to send access request email", "request", request.Id, "recipient", user.Id, "error", err)
+		}
+	}
+}
+
+// accessRequestResponse includes the requester's email so managers can tell
+// who is asking.
+func accessRequestResponse(app core.App, request *core.Record) map[string]any {
+	var email string
+	if user, err := app.FindRecordById("users", request.GetString("user")); err == nil {
+		email = user.Email()
+	}
+	return map[string]any{
+		"id":        request.Id,
+		"relay":     request.GetString("relay"),
+		"user":      request.GetString("user"),
+		"email":     email,
+		"message":   request.GetString("message"),
+		"status":    request.GetString("status"),
+		"role":      request.GetString("role"),
+		"decidedBy": request.GetString("decided_by"),
+		"decidedAt": request.GetDateTime("decided_at"),
+		"created":   request.GetDateTime("created"),
+	}
+}
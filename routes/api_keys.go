@@ -0,0 +1,330 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	apiKeyContextKey = "apiKey"
+	apiKeyScheme     = "ApiKey "
+	apiKeyPrefix     = "rcp_"
+)
+
+var errInvalidAPIKey = errors.New("invalid API key")
+
+func RegisterAPIKeyRoutes(se *core.ServeEvent) {
+	g := se.Router.Group("/api/relays/{relay}/api-keys")
+	g.Bind(apis.RequireAuth())
+	g.GET("", handleListAPIKeys)
+	g.POST("", handleCreateAPIKey)
+	g.POST("/{id}/revoke", handleRevokeAPIKey)
+}
+
+// requireUserOrAPIKey accepts either a user session or an
+// "Authorization: ApiKey rcp_<prefix>_<secret>" header. A valid key is stored
+// on the request under apiKeyContextKey and picked up by resolveRelayAuth.
+func requireUserOrAPIKey(e *core.RequestEvent) error {
+	header := e.Request.Header.Get("Authorization")
+	if !strings.HasPrefix(header, apiKeyScheme) {
+		if e.Auth == nil {
+			return e.UnauthorizedError("The request requires valid record authorization token.", nil)
+		}
+		return e.Next()
+	}
+
+	key, err := authenticateAPIKey(e.App, strings.TrimSpace(strings.TrimPrefix(header, apiKeyScheme)))
+	if err != nil {
+		return e.UnauthorizedError("Invalid API key", nil)
+	}
+
+	key.Set("last_used_at", types.NowDateTime())
+	if err := e.App.Save(key); err != nil {
+		e.App.Logger().Warn("Failed to update API key last use", "key", key.Id, "error", err)
+	}
+
+	e.Set(apiKeyContextKey, key)
+	return e.Next()
+}
+
+// authenticateAPIKey looks up a key by its prefix and checks the secret,
+// revocation and expiry.
+func authenticateAPIKey(app core.App, raw string) (*core.Record, error) {
+	prefix, secret, ok := splitAPIKey(raw)
+	if !ok {
+		return nil, errInvalidAPIKey
+	}
+
+	key, err := app.FindFirstRecordByFilter("api_keys", "prefix = {:prefix}", dbx.Params{"prefix": prefix})
+	if err != nil {
+		return nil, errInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(key.GetString("secret_hash")), []byte(hashAPIKeySecret(secret))) != 1 {
+		return nil, errInvalidAPIKey
+	}
+	if !apiKeyUsable(key) {
+		return nil, errInvalidAPIKey
+	}
+	return key, nil
+}
+
+// apiKeyUsable reports whether a key is neither revoked nor expired.
+func apiKeyUsable(key *core.Record) bool {
+	if key.GetBool("revoked") {
+		return false
+	}
+	expiresAt := key.GetDateTime("expires_at")
+	return expiresAt.IsZero() || expiresAt.Time().After(types.NowDateTime().Time())
+}
+
+// requestAPIKey returns the key set by requireUserOrAPIKey, if any.
+func requestAPIKey(e *core.RequestEvent) *core.Record {
+	key, _ := e.Get(apiKeyContextKey).(*core.Record)
+	return key
+}
+
+// resolveAPIKeyAuth is resolveRelayAuth for API keys: the relay must be the
+// key's relay and the key's role decides the authorization level.
+func resolveAPIKeyAuth(e *core.RequestEvent, key *core.Record, relayID string) (*relayAuth, error) {
+	relay, err := findRelay(e.App, relayID)
+	if err != nil || relay.Id != key.GetString("relay") {
+		return nil, e.ForbiddenError("API key is not valid for this relay", nil)
+	}
+	provider, err := e.App.FindRecordById("providers", relay.GetString("provider"))
+	if err != nil {
+		return nil, e.NotFoundError("Provider not found", nil)
+	}
+
+	return &relayAuth{
+		Relay:         relay,
+		Provider:      provider,
+		Subject:       apiKeySubject(key),
+		APIKey:        key,
+		Authorization: authorizationForRole(e.App, key.GetString("role")),
+		ProviderURL:   provider.GetString("url"),
+	}, nil
+}
+
+// resolveAPIKeyFolderAuth is resolveFolderAuth for API keys. Keys restricted
+// to a folder must name it on every request; unrestricted keys can reach any
+// non-private folder of their relay. Keys restricted to a private folder act
+// with their creator's folder access, capped by the key's own role.
+func resolveAPIKeyFolderAuth(e *core.RequestEvent, ra *relayAuth, folderID string) (*relayAuth, error) {
+	restricted := ra.APIKey.GetString("folder")
+	if folderID == "" {
+		if restricted != "" {
+			return nil, e.ForbiddenError("API key is restricted to a single folder", nil)
+		}
+		return ra, nil
+	}
+
+	folder, err := findSharedFolder(e.App, ra.Relay.Id, folderID)
+	if err != nil {
+		return nil, e.NotFoundError("Folder not found on this relay", folderErrorData(
+			"folder_not_found", "Folder not found on this relay", folderID,
+		))
+	}
+	if restricted != "" && folder.Id != restricted {
+		return nil, e.ForbiddenError("API key is restricted to another folder", folderErrorData(
+			"api_key_folder", "API key is restricted to another folder", folder.GetString("guid"),
+		))
+	}
+	if restricted == "" && folder.GetBool("private") {
+		return nil, e.ForbiddenError("No access to this private folder", folderErrorData(
+			"folder_private", "Private folders require a folder-restricted API key", folder.GetString("guid"),
+		))
+	}
+
+	fa := *ra
+	fa.Folder = folder
+	if folder.GetBool("private") {
+		fa.Authorization, err = privateFolderAuthorization(e.App, ra.Authorization, folder, ra.APIKey.GetString("created_by"))
+		if err != nil {
+			return nil, e.ForbiddenError("No access to this private folder", folderErrorData(
+				"folder_private", "The API key's creator no longer has access to this folder", folder.GetString("guid"),
+			))
+		}
+	}
+	return &fa, nil
+}
+
+// apiKeySubject is the sub claim of tokens minted with an API key.
+func apiKeySubject(key *core.Record) string {
+	return "apikey:" + key.Id
+}
+
+func handleListAPIKeys(e *core.RequestEvent) error {
+	relay, err := relayWithCapability(e, capManageMembers, "Not allowed to manage API keys for this relay")
+	if err != nil {
+		return err
+	}
+
+	keys, err := e.App.FindRecordsByFilter("api_keys", "relay = {:relay}", "-created", 0, 0, dbx.Params{"relay": relay.Id})
+	if err != nil {
+		return e.InternalServerError("Failed to load API keys", nil)
+	}
+	items := make([]map[string]any, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, apiKeyResponse(key))
+	}
+	return e.JSON(200, map[string]any{"items": items})
+}
+
+// handleCreateAPIKey creates a key and returns its secret. The secret is
+// only shown once; afterwards only its hash is kept.
+func handleCreateAPIKey(e *core.RequestEvent) error {
+	relay, err := relayWithCapability(e, capManageMembers, "Not allowed to manage API keys for this relay")
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		Name      string         `json:"name"`
+		Role      string         `json:"role"`
+		Folder    string         `json:"folder"`
+		ExpiresAt types.DateTime `json:"expiresAt"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid request body", nil)
+	}
+	if body.Name == "" {
+		return e.BadRequestError("name is required", nil)
+	}
+	if body.Role == "" {
+		body.Role = memberRoleID
+	}
+	if _, err := e.App.FindRecordById("roles", body.Role); err != nil {
+		return e.BadRequestError("Unknown role", nil)
+	}
+	if !canGrantRole(e.App, e.Auth.Id, relay.Id, body.Role) {
+		return roleNotGrantableError(e)
+	}
+	if !body.ExpiresAt.IsZero() && !body.ExpiresAt.Time().After(types.NowDateTime().Time()) {
+		return e.BadRequestError("expiresAt must be in the future", nil)
+	}
+
+	col, err := e.App.FindCollectionByNameOrId("api_keys")
+	if err != nil {
+		return e.InternalServerError("Collection not found", nil)
+	}
+	key := core.NewRecord(col)
+
+	if body.Folder != "" {
+		folder, err := findSharedFolder(e.App, relay.Id, body.Folder)
+		if err != nil {
+			return e.NotFoundError("Folder not found on this relay", nil)
+		}
+		if folder.GetBool("private") {
+			if _, err := findFolderRole(e.App, folder.Id, e.Auth.Id); err != nil {
+				return e.ForbiddenError("No access to this private folder", folderErrorData(
+					"folder_private", "Private folder requires folder membership", folder.GetString("guid"),
+				))
+			}
+		}
+		key.Set("folder", folder.Id)
+	}
+
+	prefix, err := generateRandomHex(6)
+	if err != nil {
+		return e.InternalServerError("Failed to generate API key", nil)
+	}
+	secret, err := generateRandomHex(32)
+	if err != nil {
+		return e.InternalServerError("Failed to generate API key", nil)
+	}
+
+	key.Set("name", body.Name)
+	key.Set("prefix", prefix)
+	key.Set("secret_hash", hashAPIKeySecret(secret))
+	key.Set("relay", relay.Id)
+	key.Set("role", body.Role)
+	key.Set("created_by", e.Auth.Id)
+	if !body.ExpiresAt.IsZero() {
+		key.Set("expires_at", body.ExpiresAt)
+	}
+	if err := e.App.Save(key); err != nil {
+		return e.InternalServerError("Failed to create API key", nil)
+	}
+
+	resp := apiKeyResponse(key)
+	resp["key"] = apiKeyPrefix + prefix + "_" + secret
+	return e.JSON(200, resp)
+}
+
+// handleRevokeAPIKey disables a key and revokes the tokens minted with it.
+func handleRevokeAPIKey(e *core.RequestEvent) error {
+	relay, err := relayWithCapability(e, capManageMembers, "Not allowed to manage API keys for this relay")
+	if err != nil {
+		return err
+	}
+
+	key, err := e.App.FindFirstRecordByFilter(
+		"api_keys",
+		"id = {:id} && relay = {:relay}",
+		dbx.Params{"id": e.Request.PathValue("id"), "relay": relay.Id},
+	)
+	if err != nil {
+		return e.NotFoundError("API key not found", nil)
+	}
+
+	n, err := revokeAPIKey(e.App, key)
+	if err != nil {
+		return e.InternalServerError("Failed to revoke API key", nil)
+	}
+
+	resp := apiKeyResponse(key)
+	resp["revokedTokens"] = n
+	return e.JSON(200, resp)
+}
+
+// revokeAPIKey disables a key and revokes the tokens minted with it,
+// returning how many tokens were revoked.
+func revokeAPIKey(app core.App, key *core.Record) (int, error) {
+	key.Set("revoked", true)
+	if err := app.Save(key); err != nil {
+		return 0, err
+	}
+	return revokeTokens(app, "api_key = {:key}", dbx.Params{"key": key.Id})
+}
+
+func apiKeyResponse(key *core.Record) map[string]any {
+	return map[string]any{
+		"id":         key.Id,
+		"name":       key.GetString("name"),
+		"prefix":     apiKeyPrefix + key.GetString("prefix"),
+		"role":       key.GetString("role"),
+		"folder":     key.GetString("folder"),
+		"expiresAt":  key.GetDateTime("expires_at"),
+		"revoked":    key.GetBool("revoked"),
+		"lastUsedAt": key.GetDateTime("last_used_at"),
+		"created":    key.GetDateTime("created"),
+	}
+}
+
+// splitAPIKey splits "rcp_<prefix>_<secret>" into its prefix and secret.
+func splitAPIKey(raw string) (prefix string, secret string, ok bool) {
+	rest, found := strings.CutPrefix(raw, apiKeyPrefix)
+	if !found {
+		return "", "", false
+	}
+	prefix, secret, found = strings.Cut(rest, "_")
+	if !found || prefix == "" || secret == "" {
+		return "", "", false
+	}
+	return prefix, secret, true
+}
+
+// hashAPIKeySecret hashes a key secret for storage. Secrets are 256-bit
+// random values, so a plain SHA-256 is sufficient.
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
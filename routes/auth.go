@@ -2,6 +2,7 @@ package routes
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
 	"time"
@@ -12,62 +13,173 @@ import (
 	"relay-control-plane/cwt"
 )
 
-const ownerRoleID = "2arnubkcv7jpce8"
-const memberRoleID = "x6lllh2qsf9lxk6"
-
 type relayAuth struct {
 	Relay         *core.Record
 	Provider      *core.Record
+	Folder        *core.Record // set by resolveFolderAuth
+	APIKey        *core.Record // set when authenticated with an API key
+	Subject       string       // sub claim: the user ID, or apiKeySubject
 	Authorization string
 	ProviderURL   string
 }
 
+var (
+	errRelayNotFound    = errors.New("relay not found")
+	errNoRelayAccess    = errors.New("no access to this relay")
+	errProviderNotFound = errors.New("provider not found")
+)
+
 // resolveRelayAuth loads the relay, verifies user access, and determines authorization level.
 // relayID can be either a PocketBase record ID or a relay guid.
 func resolveRelayAuth(e *core.RequestEvent, relayID string) (*relayAuth, error) {
-	relay, err := e.App.FindRecordById("relays", relayID)
+	if key := requestAPIKey(e); key != nil {
+		return resolveAPIKeyAuth(e, key, relayID)
+	}
+
+	ra, err := loadRelayAuth(e.App, relayID, e.Auth.Id)
+	switch {
+	case errors.Is(err, errRelayNotFound):
+		return nil, e.NotFoundError("Relay not found", nil)
+	case errors.Is(err, errNoRelayAccess):
+		return nil, e.ForbiddenError("No access to this relay", nil)
+	case errors.Is(err, errProviderNotFound):
+		return nil, e.NotFoundError("Provider not found", nil)
+	}
+	return ra, err
+}
+
+// loadRelayAuth is resolveRelayAuth for an arbitrary user, outside of a request.
+func loadRelayAuth(app core.App, relayID string, userID string) (*relayAuth, error) {
+	relay, err := findRelay(app, relayID)
 	if err != nil {
-		// Fall back to lookup by guid
-		relay, err = e.App.FindFirstRecordByFilter(
-			"relays",
-			"guid = {:guid}",
-			dbx.Params{"guid": relayID},
-		)
-		if err != nil {
-			return nil, e.NotFoundError("Relay not found", nil)
-		}
+		return nil, errRelayNotFound
 	}
 
-	userID := e.Auth.Id
-	relayRole, err := e.App.FindFirstRecordByFilter(
+	relayRole, err := app.FindFirstRecordByFilter(
 		"relay_roles",
 		"user = {:user} && relay = {:relay}",
 		dbx.Params{"user": userID, "relay": relay.Id},
 	)
 	if err != nil {
-		return nil, e.ForbiddenError("No access to this relay", nil)
+		return nil, errNoRelayAccess
 	}
 
-	roleID := relayRole.GetString("role")
-	authorization := "read-only"
-	if roleID == ownerRoleID || roleID == memberRoleID {
-		authorization = "full"
-	}
+	authorization := authorizationForRole(app, relayRole.GetString("role"))
 
 	providerID := relay.GetString("provider")
-	provider, err := e.App.FindRecordById("providers", providerID)
+	provider, err := app.FindRecordById("providers", providerID)
 	if err != nil {
-		return nil, e.NotFoundError("Provider not found", nil)
+		return nil, errProviderNotFound
 	}
 
 	return &relayAuth{
 		Relay:         relay,
 		Provider:      provider,
+		Subject:       userID,
 		Authorization: authorization,
 		ProviderURL:   provider.GetString("url"),
 	}, nil
 }
 
+// authorizationForRole maps a role to a token authorization level. Roles
+// without the issue_rw_token capability get read-only tokens.
+func authorizationForRole(app core.App, roleID string) string {
+	if roleHasCapability(app, roleID, capIssueRWToken) {
+		return "full"
+	}
+	return "read-only"
+}
+
+// lowerAuthorization returns the more restrictive of two authorization levels.
+func lowerAuthorization(a string, b string) string {
+	if a == "full" && b == "full" {
+		return "full"
+	}
+	return "read-only"
+}
+
+// findRelay loads a relay by PocketBase record ID, falling back to its guid.
+func findRelay(app core.App, relayID string) (*core.Record, error) {
+	relay, err := app.FindRecordById("relays", relayID)
+	if err == nil {
+		return relay, nil
+	}
+	return app.FindFirstRecordByFilter(
+		"relays",
+		"guid = {:guid}",
+		dbx.Params{"guid": relayID},
+	)
+}
+
+// getSigningKey loads the global token signing key from the environment.
+// RELAY_KEY_TYPE selects the algorithm (hmac by default). HMAC secrets are read
+// from RELAY_HMAC_KEY; Ed25519 and ES256 keys from RELAY_PRIVATE_KEY as base64
+// PKCS#8 DER, and A256GCM keys from RELAY_PRIVATE_KEY as base64 raw bytes.
+func getSigningKey() (cwt.Key, error) {
+	keyType, err := cwt.ParseKeyType(os.Getenv("RELAY_KEY_TYPE"))
+	if err != nil {
+		return cwt.Key{}, err
+	}
+	if keyType == cwt.KeyTypeHMAC {
+		secret, err := getHMACKey()
+		if err != nil {
+			return cwt.Key{}, err
+		}
+		return cwt.NewHMACKey(getKeyID(), secret), nil
+	}
+
+	keyB64 := os.Getenv("RELAY_PRIVATE_KEY")
+	if keyB64 == "" {
+		return cwt.Key{}, fmt.Errorf("RELAY_PRIVATE_KEY not set")
+	}
+	der, err := base64.StdEncoding.DecodeString(keyB64)
+	if err != nil {
+		return cwt.Key{}, err
+	}
+	return cwt.ParsePrivateKey(getKeyID(), keyType, der)
+}
+
+// providerSigningKey returns the key tokens for a provider's relays are signed
+// with. Self-hosted providers carry their own key material; the default
+// provider signs with the global keyring.
+func providerSigningKey(app core.App, provider *core.Record) (cwt.Key, error) {
+	if !provider.GetBool("self_hosted") {
+		key, err := activeSigningKey(app)
+		if err != nil {
+			return cwt.Key{}, err
+		}
+		return withProviderMACAlgorithm(key, provider), nil
+	}
+
+	keyType, err := cwt.ParseKeyType(provider.GetString("key_type"))
+	if err != nil {
+		return cwt.Key{}, err
+	}
+	keyID := provider.GetString("key_id")
+
+	material, err := base64.StdEncoding.DecodeString(provider.GetString("private_key"))
+	if err != nil {
+		return cwt.Key{}, err
+	}
+	if len(material) == 0 {
+		return cwt.Key{}, fmt.Errorf("provider %s has no private_key", provider.Id)
+	}
+	key, err := cwt.ParsePrivateKey(keyID, keyType, material)
+	if err != nil {
+		return cwt.Key{}, err
+	}
+	return withProviderMACAlgorithm(key, provider), nil
+}
+
+// withProviderMACAlgorithm applies the provider's mac_alg to HMAC keys.
+// Providers that don't set one keep HMAC 256/64.
+func withProviderMACAlgorithm(key cwt.Key, provider *core.Record) cwt.Key {
+	if key.Type == cwt.KeyTypeHMAC {
+		key.MACAlgorithm = int64(provider.GetInt("mac_alg"))
+	}
+	return key
+}
+
 func getHMACKey() ([]byte, error) {
 	keyB64 := os.Getenv("RELAY_HMAC_KEY")
 	if keyB64 == "" {
@@ -76,7 +188,7 @@ func getHMACKey() ([]byte, error) {
 	return base64.StdEncoding.DecodeString(keyB64)
 }
 
-func getHMACKeyID() string {
+func getKeyID() string {
 	kid := os.Getenv("RELAY_HMAC_KEY_ID")
 	if kid == "" {
 		return "default"
@@ -84,6 +196,25 @@ func getHMACKeyID() string {
 	return kid
 }
 
+// encodePublicKey returns the base64 key material handed to relays.
+func encodePublicKey(key cwt.Key) (string, error) {
+	pub, err := key.PublicKey()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(pub), nil
+}
+
+// recordPublicKey returns the public_key stored on provider and signing key
+// records. Symmetric keys have no public half, and their secret stays in the
+// hidden private_key field, so it is empty for them.
+func recordPublicKey(key cwt.Key) (string, error) {
+	if key.Type.Symmetric() {
+		return "", nil
+	}
+	return encodePublicKey(key)
+}
+
 func getIssuer() string {
 	issuer := os.Getenv("RELAY_ISSUER")
 	if issuer == "" {
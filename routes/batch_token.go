@@ -0,0 +1,152 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+// maxBatchTokens caps the number of tokens minted by a single /tokens call.
+const maxBatchTokens = 500
+
+func RegisterBatchTokenRoutes(se *core.ServeEvent) {
+	se.Router.POST("/tokens", handleBatchTokens).
+		Bind(apis.RequireAuth()).
+		BindFunc(requireRateLimit(se.App, tokenRateLimits, batchTokenCost))
+}
+
+// batchTokenItem is a single entry of a /tokens request. Entries with a hash
+// mint a file token, all others a document token, covering Files as on
+// /token. ID is an optional client key for the response map; it defaults to
+// the hash for file entries and the docId otherwise, and must be unique.
+type batchTokenItem struct {
+	ID    string   `json:"id"`
+	Files []string `json:"files"`
+	fileTokenRequest
+}
+
+func (item batchTokenItem) key() string {
+	switch {
+	case item.ID != "":
+		return item.ID
+	case item.Hash != "":
+		return item.Hash
+	}
+	return item.DocID
+}
+
+// batchTokenCost charges a /tokens request one rate limit token per item, up
+// to maxBatchTokens. Batches larger than the caller's burst are rejected
+// rather than charged less. The body stays readable for the handler.
+func batchTokenCost(e *core.RequestEvent) int {
+	var body struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return 1
+	}
+	return min(max(len(body.Items), 1), maxBatchTokens)
+}
+
+// handleBatchTokens mints tokens for many documents and files at once.
+// Relay auth is resolved once per relay, and failures are reported per item
+// instead of failing the whole request. Each relay's rate limit is charged
+// for all of its items at once, however the client named the relay.
+func handleBatchTokens(e *core.RequestEvent) error {
+	var body struct {
+		Items []batchTokenItem `json:"items"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid request body", nil)
+	}
+	if len(body.Items) == 0 {
+		return e.BadRequestError("items is required", nil)
+	}
+	if len(body.Items) > maxBatchTokens {
+		return e.BadRequestError(fmt.Sprintf("At most %d items are allowed", maxBatchTokens), nil)
+	}
+	keys := make(map[string]bool, len(body.Items))
+	for _, item := range body.Items {
+		if keys[item.key()] {
+			return e.BadRequestError(fmt.Sprintf("Duplicate item key %q", item.key()), nil)
+		}
+		keys[item.key()] = true
+	}
+
+	type resolved struct {
+		ra  *relayAuth
+		err error
+	}
+	relays := map[string]resolved{}
+	relayItems := map[string]int{}
+	for _, item := range body.Items {
+		r, ok := relays[item.Relay]
+		if !ok {
+			ra, err := resolveRelayAuth(e, item.Relay)
+			r = resolved{ra: ra, err: err}
+			relays[item.Relay] = r
+		}
+		if r.err == nil {
+			relayItems[r.ra.Relay.Id]++
+		}
+	}
+	limited := make(map[string]error, len(relayItems))
+	for relayID, n := range relayItems {
+		limited[relayID] = takeRelayRateLimit(e, tokenRateLimits, relayID, n)
+	}
+
+	tokens := make(map[string]any, len(body.Items))
+	for _, item := range body.Items {
+		r := relays[item.Relay]
+		if r.err == nil {
+			r.err = limited[r.ra.Relay.Id]
+		}
+		if r.err != nil {
+			tokens[item.key()] = batchItemError(r.err)
+			continue
+		}
+
+		ra, err := resolveFolderAuth(e, r.ra, item.Folder)
+		if err != nil {
+			tokens[item.key()] = batchItemError(err)
+			continue
+		}
+
+		var resp map[string]any
+		if item.Hash != "" {
+			resp, err = mintFileToken(e, ra, item.fileTokenRequest)
+		} else {
+			resp, err = mintDocToken(e, ra, docTokenRequest{
+				DocID:  item.DocID,
+				Relay:  item.Relay,
+				Folder: item.Folder,
+				Files:  item.Files,
+			})
+		}
+		if err != nil {
+			tokens[item.key()] = batchItemError(err)
+			continue
+		}
+		tokens[item.key()] = resp
+	}
+
+	return e.JSON(200, map[string]any{"tokens": tokens})
+}
+
+// batchItemError converts a handler error into a per-item error entry.
+func batchItemError(err error) map[string]any {
+	apiErr := router.NewInternalServerError("Failed to generate token", nil)
+	errors.As(err, &apiErr)
+
+	return map[string]any{
+		"error": map[string]any{
+			"status":  apiErr.Status,
+			"message": apiErr.Message,
+			"data":    apiErr.Data,
+		},
+	}
+}
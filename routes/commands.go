@@ -0,0 +1,226 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+	"github.com/veraison/go-cose"
+
+	"relay-control-plane/cwt"
+)
+
+// RegisterTokenCommands adds the `token` debugging subcommands. They work on
+// the local data dir and do not need a running server.
+func RegisterTokenCommands(app *pocketbase.PocketBase) {
+	tokenCmd := &cobra.Command{
+		Use:   "token",
+		Short: "Mint and inspect relay tokens",
+	}
+	tokenCmd.AddCommand(newTokenMintCommand(app), newTokenDecodeCommand(app))
+	app.RootCmd.AddCommand(tokenCmd)
+}
+
+func newTokenMintCommand(app core.App) *cobra.Command {
+	var relayID, docID, folderID, userID string
+	var files []string
+	var ttl int
+	var readOnly bool
+
+	cmd := &cobra.Command{
+		Use:   "mint",
+		Short: "Mint a token for a relay member",
+		Long: "Mint a token signed with the relay provider's key and record it in the token ledger.\n" +
+			"The authorization level comes from the user's role on the relay, capped by their role\n" +
+			"on a private --folder, and the lifetime from the relay's token policy unless --ttl is\n" +
+			"given. Relays with private folders require --folder, as the token routes do.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if docID == "" && folderID == "" {
+				return errors.New("one of --doc or --folder is required")
+			}
+			if len(files) > 0 && docID == "" {
+				return errors.New("--file requires --doc")
+			}
+			if ttl != 0 && (ttl < minTokenTTL || ttl > maxTokenTTL) {
+				return fmt.Errorf("--ttl must be between %d and %d seconds", minTokenTTL, maxTokenTTL)
+			}
+
+			user, err := findUser(app, userID)
+			if err != nil {
+				return fmt.Errorf("user %q not found", userID)
+			}
+			ra, err := loadRelayAuth(app, relayID, user.Id)
+			if err != nil {
+				return err
+			}
+			if readOnly {
+				ra.Authorization = "read-only"
+			}
+
+			if folderID == "" {
+				private, err := relayHasPrivateFolders(app, ra.Relay.Id)
+				if err != nil {
+					return err
+				}
+				if private {
+					return errors.New("--folder is required on relays with private folders")
+				}
+			}
+
+			var scopes []cwt.Scope
+			if folderID != "" {
+				folder, err := findSharedFolder(app, ra.Relay.Id, folderID)
+				if err != nil {
+					return fmt.Errorf("folder %q not found on this relay", folderID)
+				}
+				if folder.GetBool("private") {
+					ra.Authorization, err = privateFolderAuthorization(app, ra.Authorization, folder, user.Id)
+					if err != nil {
+						return fmt.Errorf("user has no role on private folder %q", folderID)
+					}
+				}
+				ra.Folder = folder
+				if docID == "" {
+					scopes = append(scopes, cwt.FolderScope(folder.GetString("guid"), ra.Authorization))
+				}
+			}
+			if docID != "" {
+				docScopes := []cwt.Scope{cwt.DocScope(docID, ra.Authorization)}
+				for _, hash := range files {
+					docScopes = append(docScopes, cwt.FileScope(hash, docID, ra.Authorization))
+				}
+				scopes = append(scopes, scopeToFolder(ra, docScopes)...)
+			}
+			for _, scope := range scopes {
+				if err := scope.Validate(); err != nil {
+					return err
+				}
+			}
+
+			if ttl == 0 {
+				ttl = tokenTTL(app, ra, tokenKindDoc)
+			}
+			key, err := providerSigningKey(app, ra.Provider)
+			if err != nil {
+				return fmt.Errorf("loading signing key: %w", err)
+			}
+			token, err := signToken(app, key, ra, scopes, ttl)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), token)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&relayID, "relay", "", "relay record ID or guid")
+	cmd.Flags().StringVar(&userID, "user", "", "user record ID or email")
+	cmd.Flags().StringVar(&docID, "doc", "", "document ID")
+	cmd.Flags().StringArrayVar(&files, "file", nil, "file hash embedded in --doc (repeatable)")
+	cmd.Flags().StringVar(&folderID, "folder", "", "shared folder guid or ID")
+	cmd.Flags().IntVar(&ttl, "ttl", 0, "lifetime in seconds (default: relay token policy)")
+	cmd.Flags().BoolVar(&readOnly, "read-only", false, "issue a read-only token regardless of role")
+	cmd.MarkFlagRequired("relay")
+	cmd.MarkFlagRequired("user")
+	return cmd
+}
+
+func newTokenDecodeCommand(app core.App) *cobra.Command {
+	return &cobra.Command{
+		Use:          "decode <token>",
+		Short:        "Print a token's headers and claims and check it against the configured keys",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, err := cwt.Parse(args[0])
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "kid:\t%s\n", token.KeyID)
+			fmt.Fprintf(w, "alg:\t%d (%s)\n", token.Algorithm, algorithmName(token.Algorithm))
+
+			// Encrypted tokens only have readable claims once VerifyKey
+			// has decrypted them, so check the key before printing claims.
+			check := "mac"
+			switch token.Algorithm {
+			case int64(cose.AlgorithmES256), int64(cose.AlgorithmEdDSA):
+				check = "signature"
+			case cwt.AlgA256GCM:
+				check = "decryption"
+			}
+			keys, err := keyringForKeyID(app, token.KeyID)
+			if err != nil {
+				fmt.Fprintf(w, "%s:\tunknown (%v)\n", check, err)
+			} else if err := token.VerifyKey(keys); err != nil {
+				fmt.Fprintf(w, "%s:\tinvalid (%v)\n", check, err)
+			} else {
+				fmt.Fprintf(w, "%s:\tvalid\n", check)
+			}
+			printClaims(w, token.Claims)
+
+			status := "valid"
+			if err := token.Claims.Validate(cwt.VerifyOptions{Issuer: getIssuer(), Leeway: tokenClockSkew}); err != nil {
+				status = err.Error()
+			}
+			fmt.Fprintf(w, "claims:\t%s\n", status)
+			return w.Flush()
+		},
+	}
+}
+
+func printClaims(w io.Writer, c cwt.Claims) {
+	fmt.Fprintf(w, "jti:\t%s\n", c.ID)
+	fmt.Fprintf(w, "iss:\t%s\n", c.Issuer)
+	fmt.Fprintf(w, "sub:\t%s\n", c.Subject)
+	fmt.Fprintf(w, "aud:\t%s\n", c.Audience)
+	fmt.Fprintf(w, "iat:\t%s\n", formatClaimTime(c.IssuedAt))
+	fmt.Fprintf(w, "nbf:\t%s\n", formatClaimTime(c.NotBefore))
+	fmt.Fprintf(w, "exp:\t%s\n", formatClaimTime(c.ExpiresAt))
+	fmt.Fprintf(w, "scope:\t%s\n", cwt.FormatScopes(c.Scopes))
+}
+
+func algorithmName(alg int64) string {
+	switch alg {
+	case cwt.AlgA256GCM:
+		return "A256GCM"
+	case cwt.AlgHMAC256Trunc64:
+		return "HMAC 256/64"
+	case cwt.AlgHMAC256:
+		return "HMAC 256/256"
+	case cwt.AlgHMAC384:
+		return "HMAC 384/384"
+	case cwt.AlgHMAC512:
+		return "HMAC 512/512"
+	case int64(cose.AlgorithmES256):
+		return "ES256"
+	case int64(cose.AlgorithmEdDSA):
+		return "EdDSA"
+	}
+	return "unknown"
+}
+
+func formatClaimTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// findUser loads a user by record ID, falling back to email.
+func findUser(app core.App, idOrEmail string) (*core.Record, error) {
+	user, err := app.FindRecordById("users", idOrEmail)
+	if err == nil {
+		return user, nil
+	}
+	return app.FindAuthRecordByEmail("users", idOrEmail)
+}
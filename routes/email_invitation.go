@@ -0,0 +1,209 @@
+package routes
+
+import (
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// emailInvitationTTL is how long an emailed invitation stays valid.
+const emailInvitationTTL = 7 * 24 * time.Hour
+
+func RegisterEmailInvitationRoutes(se *core.ServeEvent) {
+	g := se.Router.Group("/api/relays/{relay}/invitations")
+	g.Bind(apis.RequireAuth())
+	g.GET("", handleListEmailInvitations)
+	g.POST("", handleCreateEmailInvitation)
+	g.DELETE("/{id}", handleCancelEmailInvitation)
+}
+
+// handleCreateEmailInvitation invites an email address to a relay and mails
+// it a single-use invite. Inviting the same address again replaces its
+// pending invitation.
+func handleCreateEmailInvitation(e *core.RequestEvent) error {
+	relay, err := relayWithCapability(e, capManageInvites, "Not allowed to invite members to this relay")
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid request body", nil)
+	}
+	addr, err := mail.ParseAddress(body.Email)
+	if err != nil || addr.Address != body.Email {
+		return e.BadRequestError("A valid email is required", nil)
+	}
+	email := strings.ToLower(addr.Address)
+	if body.Role == "" {
+		body.Role = memberRoleID
+	}
+	role, err := e.App.FindRecordById("roles", body.Role)
+	if err != nil {
+		return e.BadRequestError("Unknown role", nil)
+	}
+	if !canGrantRole(e.App, e.Auth.Id, relay.Id, role.Id) {
+		return roleNotGrantableError(e)
+	}
+
+	if user, err := e.App.FindAuthRecordByEmail("users", email); err == nil {
+		if _, err := findMembership(e.App, relay.Id, user.Id); err == nil {
+			return e.Error(409, "Already a member of this relay", nil)
+		}
+	}
+
+	col, err := e.App.FindCollectionByNameOrId("relay_invitations")
+	if err != nil {
+		return e.InternalServerError("Collection not found", nil)
+	}
+	key, err := generateRandomHex(16)
+	if err != nil {
+		return e.InternalServerError("Failed to generate key", nil)
+	}
+
+	invitation := core.NewRecord(col)
+	invitation.Set("relay", relay.Id)
+	invitation.Set("role", role.Id)
+	invitation.Set("key", key)
+	invitation.Set("enabled", true)
+	invitation.Set("email", email)
+	invitation.Set("invited_by", e.Auth.Id)
+	invitation.Set("max_uses", 1)
+	invitation.Set("expires_at", time.Now().Add(emailInvitationTTL))
+
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		previous, err := txApp.FindRecordsByFilter(
+			"relay_invitations",
+			"relay = {:relay} && email = {:email}",
+			"", 0, 0,
+			dbx.Params{"relay": relay.Id, "email": email},
+		)
+		if err != nil {
+			return err
+		}
+		for _, p := range previous {
+			if err := txApp.Delete(p); err != nil {
+				return err
+			}
+		}
+		return txApp.Save(invitation)
+	})
+	if err != nil {
+		return e.InternalServerError("Failed to create invitation", nil)
+	}
+
+	if err := sendInvitationEmail(e, relay, role, invitation); err != nil {
+		e.App.Logger().Error("Failed to send invitation email", "invitation", invitation.Id, "error", err)
+		if err := e.App.Delete(invitation); err != nil {
+			e.App.Logger().Warn("Failed to delete unsent invitation", "invitation", invitation.Id, "error", err)
+		}
+		return e.InternalServerError("Failed to send invitation email", nil)
+	}
+
+	return e.JSON(200, emailInvitationResponse(invitation))
+}
+
+// handleListEmailInvitations lists a relay's emailed invitations that can
+// still be accepted.
+func handleListEmailInvitations(e *core.RequestEvent) error {
+	relay, err := relayWithCapability(e, capManageInvites, "Not allowed to view invitations for this relay")
+	if err != nil {
+		return err
+	}
+
+	invitations, err := e.App.FindRecordsByFilter(
+		"relay_invitations",
+		"relay = {:relay} && email != '' && enabled = true && expires_at > {:now} && use_count < max_uses",
+		"expires_at", 0, 0,
+		dbx.Params{"relay": relay.Id, "now": types.NowDateTime().String()},
+	)
+	if err != nil {
+		return e.InternalServerError("Failed to load invitations", nil)
+	}
+
+	items := make([]map[string]any, 0, len(invitations))
+	for _, invitation := range invitations {
+		items = append(items, emailInvitationResponse(invitation))
+	}
+	return e.JSON(200, map[string]any{"items": items})
+}
+
+// handleCancelEmailInvitation deletes an emailed invitation. The relay's
+// shared invite link is managed through the relay_invitations collection.
+func handleCancelEmailInvitation(e *core.RequestEvent) error {
+	relay, err := relayWithCapability(e, capManageInvites, "Not allowed to cancel invitations for this relay")
+	if err != nil {
+		return err
+	}
+
+	invitation, err := e.App.FindFirstRecordByFilter(
+		"relay_invitations",
+		"id = {:id} && relay = {:relay} && email != ''",
+		dbx.Params{"id": e.Request.PathValue("id"), "relay": relay.Id},
+	)
+	if err != nil {
+		return e.NotFoundError("Invitation not found", nil)
+	}
+	if err := e.App.Delete(invitation); err != nil {
+		return e.InternalServerError("Failed to cancel invitation", nil)
+	}
+	return e.NoContent(204)
+}
+
+// sendInvitationEmail mails an invitation's accept link and key to the
+// invited address.
+func sendInvitationEmail(e *core.RequestEvent, relay *core.Record, role *core.Record, invitation *core.Record) error {
+	inviter := e.Auth.GetString("name")
+	if inviter == "" {
+		inviter = e.Auth.Email()
+	}
+	key := invitation.GetString("key")
+
+	return sendTemplatedEmail(
+		e.App,
+		"templates/invitation_email.html.tmpl",
+		mail.Address{Address: invitation.GetString("email")},
+		"You're invited to join "+relay.GetString("name"),
+		map[string]any{
+			"Inviter":   inviter,
+			"Relay":     relay.GetString("name"),
+			"Role":      role.GetString("name"),
+			"Email":     invitation.GetString("email"),
+			"Key":       key,
+			"Link":      invitationLink(e.App, key),
+			"ExpiresAt": invitation.GetDateTime("expires_at").Time().Format("January 2, 2006"),
+		},
+	)
+}
+
+// invitationLink builds the accept link for an invite key. RELAY_INVITE_URL
+// points it at the client's invite handler; it defaults to <app URL>/invite.
+func invitationLink(app core.App, key string) string {
+	base := os.Getenv("RELAY_INVITE_URL")
+	if base == "" {
+		base = strings.TrimRight(app.Settings().Meta.AppURL, "/") + "/invite"
+	}
+	return base + "?key=" + url.QueryEscape(key)
+}
+
+// emailInvitationResponse omits the invite key, which only the invitee
+// should receive.
+func emailInvitationResponse(invitation *core.Record) map[string]any {
+	return map[string]any{
+		"id":        invitation.Id,
+		"email":     invitation.GetString("email"),
+		"role":      invitation.GetString("role"),
+		"invitedBy": invitation.GetString("invited_by"),
+		"expiresAt": invitation.GetDateTime("expires_at"),
+	}
+}
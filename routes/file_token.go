@@ -3,25 +3,28 @@ package routes
 import (
 	"fmt"
 
-	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 
 	"relay-control-plane/cwt"
 )
 
 func RegisterFileTokenRoutes(se *core.ServeEvent) {
-	se.Router.POST("/file-token", handleFileToken).Bind(apis.RequireAuth())
+	se.Router.POST("/file-token", handleFileToken).
+		BindFunc(requireUserOrAPIKey).
+		BindFunc(requireRateLimit(se.App, tokenRateLimits, nil))
+}
+
+type fileTokenRequest struct {
+	DocID         string `json:"docId"`
+	Relay         string `json:"relay"`
+	Folder        string `json:"folder"`
+	Hash          string `json:"hash"`
+	ContentType   string `json:"contentType"`
+	ContentLength int64  `json:"contentLength"`
 }
 
 func handleFileToken(e *core.RequestEvent) error {
-	var body struct {
-		DocID         string `json:"docId"`
-		Relay         string `json:"relay"`
-		Folder        string `json:"folder"`
-		Hash          string `json:"hash"`
-		ContentType   string `json:"contentType"`
-		ContentLength int64  `json:"contentLength"`
-	}
+	var body fileTokenRequest
 	if err := e.BindBody(&body); err != nil {
 		return e.BadRequestError("Invalid request body", nil)
 	}
@@ -30,34 +33,44 @@ func handleFileToken(e *core.RequestEvent) error {
 	if err != nil {
 		return err
 	}
+	if err := takeRelayRateLimit(e, tokenRateLimits, ra.Relay.Id, 1); err != nil {
+		return err
+	}
+	ra, err = resolveFolderAuth(e, ra, body.Folder)
+	if err != nil {
+		return err
+	}
 
-	key, err := getHMACKey()
+	resp, err := mintFileToken(e, ra, body)
 	if err != nil {
-		return e.InternalServerError("HMAC key not configured", nil)
+		return err
 	}
-	keyID := getHMACKeyID()
-	issuer := getIssuer()
+	return e.JSON(200, resp)
+}
 
-	const expirySeconds = 3600
-	token, err := cwt.GenerateFileToken(key, keyID, issuer, body.DocID, e.Auth.Id, ra.ProviderURL, ra.Authorization, expirySeconds, body.Hash)
+// mintFileToken issues a file token and builds the /file-token response body.
+func mintFileToken(e *core.RequestEvent, ra *relayAuth, req fileTokenRequest) (map[string]any, error) {
+	expirySeconds := tokenTTL(e.App, ra, tokenKindFile)
+	scopes := scopeToFolder(ra, []cwt.Scope{cwt.FileScope(req.Hash, req.DocID, ra.Authorization)})
+	token, err := issueToken(e, ra, scopes, expirySeconds)
 	if err != nil {
-		return e.InternalServerError("Failed to generate token", nil)
+		return nil, err
 	}
 
 	wsURL, httpURL, err := buildProviderURLs(ra.ProviderURL)
 	if err != nil {
-		return e.InternalServerError("Invalid provider URL", nil)
+		return nil, e.InternalServerError("Invalid provider URL", nil)
 	}
 
-	return e.JSON(200, map[string]any{
-		"url":           fmt.Sprintf("%s/d/%s/ws", wsURL, body.DocID),
-		"baseUrl":       fmt.Sprintf("%s/f/%s", httpURL, body.DocID),
-		"docId":         body.DocID,
+	return map[string]any{
+		"url":           fmt.Sprintf("%s/d/%s/ws", wsURL, req.DocID),
+		"baseUrl":       fmt.Sprintf("%s/f/%s", httpURL, req.DocID),
+		"docId":         req.DocID,
 		"token":         token,
 		"authorization": ra.Authorization,
 		"expiryTime":    expiryTime(expirySeconds),
-		"fileHash":      body.Hash,
-		"contentType":   body.ContentType,
-		"contentLength": body.ContentLength,
-	})
+		"fileHash":      req.Hash,
+		"contentType":   req.ContentType,
+		"contentLength": req.ContentLength,
+	}, nil
 }
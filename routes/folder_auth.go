@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"errors"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// resolveFolderAuth narrows relay access to a shared folder. The folder must
+// belong to the relay. Private folders additionally require a
+// shared_folder_roles entry, and the token gets the lower of the relay and
+// folder roles' authorization levels.
+// Doc and file tokens name the folder in their scopes and relays check the
+// document belongs to it. An empty folderID leaves the relay-level
+// authorization unchanged, unless the relay has private folders: a scope
+// without a folder would reach their documents, so those relays require
+// every request to name one.
+func resolveFolderAuth(e *core.RequestEvent, ra *relayAuth, folderID string) (*relayAuth, error) {
+	if folderID == "" {
+		private, err := relayHasPrivateFolders(e.App, ra.Relay.Id)
+		if err != nil {
+			return nil, e.InternalServerError("Failed to load folders", nil)
+		}
+		if private {
+			return nil, e.BadRequestError("folder is required on relays with private folders", map[string]validation.Error{
+				"folder": validation.NewError("folder_required", "folder is required on relays with private folders"),
+			})
+		}
+	}
+
+	if ra.APIKey != nil {
+		return resolveAPIKeyFolderAuth(e, ra, folderID)
+	}
+	if folderID == "" {
+		return ra, nil
+	}
+
+	folder, err := findSharedFolder(e.App, ra.Relay.Id, folderID)
+	if err != nil {
+		return nil, e.NotFoundError("Folder not found on this relay", folderErrorData(
+			"folder_not_found", "Folder not found on this relay", folderID,
+		))
+	}
+
+	fa := *ra
+	fa.Folder = folder
+	if !folder.GetBool("private") {
+		return &fa, nil
+	}
+
+	fa.Authorization, err = privateFolderAuthorization(e.App, ra.Authorization, folder, e.Auth.Id)
+	if err != nil {
+		return nil, e.ForbiddenError("No access to this private folder", folderErrorData(
+			"folder_private", "Private folder requires folder membership", folder.GetString("guid"),
+		))
+	}
+	return &fa, nil
+}
+
+var errNoFolderAccess = errors.New("no access to this private folder")
+
+// relayHasPrivateFolders reports whether any of the relay's shared folders is
+// private, in which case every token request must name a folder.
+func relayHasPrivateFolders(app core.App, relayID string) (bool, error) {
+	private, err := app.CountRecords("shared_folders", dbx.HashExp{"relay": relayID, "private": true})
+	return private > 0, err
+}
+
+// privateFolderAuthorization caps authorization at the user's role on a
+// private folder. It returns errNoFolderAccess if the user has no role on it.
+func privateFolderAuthorization(app core.App, authorization string, folder *core.Record, userID string) (string, error) {
+	folderRole, err := findFolderRole(app, folder.Id, userID)
+	if err != nil {
+		return "", errNoFolderAccess
+	}
+	return lowerAuthorization(authorization, authorizationForRole(app, folderRole.GetString("role"))), nil
+}
+
+// findFolderRole loads a user's shared_folder_roles entry for a folder.
+func findFolderRole(app core.App, folderID string, userID string) (*core.Record, error) {
+	return app.FindFirstRecordByFilter(
+		"shared_folder_roles",
+		"user = {:user} && shared_folder = {:folder}",
+		dbx.Params{"user": userID, "folder": folderID},
+	)
+}
+
+// findSharedFolder loads a relay's shared folder by guid, falling back to its
+// record ID.
+func findSharedFolder(app core.App, relayID string, folderID string) (*core.Record, error) {
+	folder, err := app.FindFirstRecordByFilter(
+		"shared_folders",
+		"guid = {:guid} && relay = {:relay}",
+		dbx.Params{"guid": folderID, "relay": relayID},
+	)
+	if err == nil {
+		return folder, nil
+	}
+	return app.FindFirstRecordByFilter(
+		"shared_folders",
+		"id = {:id} && relay = {:relay}",
+		dbx.Params{"id": folderID, "relay": relayID},
+	)
+}
+
+// folderErrorData builds error data naming the folder a request was denied for.
+func folderErrorData(code string, message string, folderGuid string) map[string]validation.Error {
+	return map[string]validation.Error{
+		"folder": validation.NewError(code, message).SetParams(map[string]any{"guid": folderGuid}),
+	}
+}
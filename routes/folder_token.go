@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+
+	"relay-control-plane/cwt"
+)
+
+func RegisterFolderTokenRoutes(se *core.ServeEvent) {
+	se.Router.POST("/folder-token", handleFolderToken).
+		Bind(apis.RequireAuth()).
+		BindFunc(requireRateLimit(se.App, tokenRateLimits, nil))
+}
+
+// handleFolderToken mints a single token covering every document in a shared
+// folder, so clients opening a vault don't need one token per document.
+func handleFolderToken(e *core.RequestEvent) error {
+	var body struct {
+		Relay  string `json:"relay"`
+		Folder string `json:"folder"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid request body", nil)
+	}
+	if body.Folder == "" {
+		return e.BadRequestError("folder is required", nil)
+	}
+
+	ra, err := resolveRelayAuth(e, body.Relay)
+	if err != nil {
+		return err
+	}
+	if err := takeRelayRateLimit(e, tokenRateLimits, ra.Relay.Id, 1); err != nil {
+		return err
+	}
+	ra, err = resolveFolderAuth(e, ra, body.Folder)
+	if err != nil {
+		return err
+	}
+	folderGuid := ra.Folder.GetString("guid")
+
+	expirySeconds := tokenTTL(e.App, ra, tokenKindDoc)
+	token, err := issueToken(e, ra, []cwt.Scope{cwt.FolderScope(folderGuid, ra.Authorization)}, expirySeconds)
+	if err != nil {
+		return err
+	}
+
+	wsURL, httpURL, err := buildProviderURLs(ra.ProviderURL)
+	if err != nil {
+		return e.InternalServerError("Invalid provider URL", nil)
+	}
+
+	return e.JSON(200, map[string]any{
+		"url":           wsURL,
+		"baseUrl":       httpURL,
+		"folder":        folderGuid,
+		"token":         token,
+		"authorization": ra.Authorization,
+		"expiryTime":    expiryTime(expirySeconds),
+	})
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/pocketbase/dbx"
@@ -44,8 +45,14 @@ func RegisterAuthHooks(app *pocketbase.PocketBase) {
 func RegisterHooks(app *pocketbase.PocketBase) {
 	app.OnRecordCreateRequest("relays").BindFunc(onRelayCreateRequest)
 	app.OnRecordCreateRequest("shared_folders").BindFunc(onSharedFolderCreateRequest)
+	app.OnRecordUpdateRequest("shared_folders").BindFunc(onSharedFolderUpdateRequest)
+	app.OnRecordUpdateRequest("relays").BindFunc(onRelayUpdateRequest)
+	app.OnRecordCreateRequest("relay_invitations").BindFunc(onRelayInvitationRequest)
+	app.OnRecordUpdateRequest("relay_invitations").BindFunc(onRelayInvitationRequest)
 	app.OnRecordDelete("relays").BindFunc(onRelayDelete)
 	app.OnRecordDelete("shared_folders").BindFunc(onSharedFolderDelete)
+	app.OnRecordUpdate("relay_roles").BindFunc(onRelayRoleUpdate)
+	app.OnRecordDelete("relay_roles").BindFunc(onRelayRoleDelete)
 }
 
 func onRelayCreateRequest(e *core.RecordRequestEvent) error {
@@ -67,6 +74,37 @@ func onRelayCreateRequest(e *core.RecordRequestEvent) error {
 	return AutoCreateRelayDeps(e.App, e.Record, creatorID)
 }
 
+// superuserRelayFields are relay fields only superusers can change through
+// the records API: user_limit caps the relay's seats, creator moves through
+// the ownership transfer flow, and the rest tie the relay to its hosting
+// and billing.
+var superuserRelayFields = []string{"user_limit", "creator", "provider", "plan", "storage_quota"}
+
+// onRelayUpdateRequest keeps superuserRelayFields under superuser control.
+func onRelayUpdateRequest(e *core.RecordRequestEvent) error {
+	if e.HasSuperuserAuth() {
+		return e.Next()
+	}
+	for _, field := range superuserRelayFields {
+		if e.Record.GetString(field) != e.Record.Original().GetString(field) {
+			return e.ForbiddenError(fmt.Sprintf("Only administrators can change %s", field), nil)
+		}
+	}
+	return e.Next()
+}
+
+// onRelayInvitationRequest keeps invite links from handing out a role with
+// capabilities their creator doesn't hold.
+func onRelayInvitationRequest(e *core.RecordRequestEvent) error {
+	if e.HasSuperuserAuth() || e.Auth == nil {
+		return e.Next()
+	}
+	if !canGrantRole(e.App, e.Auth.Id, e.Record.GetString("relay"), e.Record.GetString("role")) {
+		return roleNotGrantableError(e.RequestEvent)
+	}
+	return e.Next()
+}
+
 func assignDefaultProvider(app core.App, record *core.Record) error {
 	providerURL := os.Getenv("RELAY_DEFAULT_PROVIDER_URL")
 	if providerURL == "" {
@@ -79,18 +117,33 @@ func assignDefaultProvider(app core.App, record *core.Record) error {
 		dbx.Params{"url": providerURL},
 	)
 	if err != nil {
+		key, err := activeSigningKey(app)
+		if err != nil {
+			return err
+		}
+		publicKey, err := recordPublicKey(key)
+		if err != nil {
+			return err
+		}
+
 		provCol, err := app.FindCollectionByNameOrId("providers")
 		if err != nil {
 			return err
 		}
 
+		apiSecret, err := generateRandomHex(32)
+		if err != nil {
+			return err
+		}
+
 		provider = core.NewRecord(provCol)
 		provider.Set("url", providerURL)
 		provider.Set("name", providerURL)
 		provider.Set("self_hosted", false)
-		provider.Set("public_key", os.Getenv("RELAY_HMAC_KEY"))
-		provider.Set("key_id", getHMACKeyID())
-		provider.Set("key_type", "hmac")
+		provider.Set("public_key", publicKey)
+		provider.Set("key_id", key.ID)
+		provider.Set("key_type", string(key.Type))
+		provider.Set("api_secret", apiSecret)
 
 		if err := app.Save(provider); err != nil {
 			return err
@@ -127,6 +180,21 @@ func onSharedFolderCreateRequest(e *core.RecordRequestEvent) error {
 	return e.App.Save(sfr)
 }
 
+// onSharedFolderUpdateRequest lets only a private folder's members make it
+// public, since manage_folders alone would otherwise open it to the relay.
+func onSharedFolderUpdateRequest(e *core.RecordRequestEvent) error {
+	if e.HasSuperuserAuth() || !e.Record.Original().GetBool("private") || e.Record.GetBool("private") {
+		return e.Next()
+	}
+	if e.Auth == nil {
+		return e.ForbiddenError("Only members of a private folder can make it public", nil)
+	}
+	if _, err := findFolderRole(e.App, e.Record.Id, e.Auth.Id); err != nil {
+		return e.ForbiddenError("Only members of a private folder can make it public", nil)
+	}
+	return e.Next()
+}
+
 func onRelayDelete(e *core.RecordEvent) error {
 	relayID := e.Record.Id
 
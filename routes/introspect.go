@@ -0,0 +1,155 @@
+package routes
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+
+	"relay-control-plane/cwt"
+)
+
+func RegisterIntrospectRoutes(se *core.ServeEvent) {
+	se.Router.POST("/introspect", handleIntrospect).BindFunc(requireProviderAuth)
+}
+
+// handleIntrospect implements RFC 7662 token introspection for relay servers.
+// A token is active when it verifies against the calling provider's keys, was
+// issued for that provider, has not been revoked, and its subject (user or
+// API key) still holds a role on the relay. Inactive tokens get only {"active": false}, without
+// saying why.
+func handleIntrospect(e *core.RequestEvent) error {
+	var body struct {
+		Token string `json:"token" form:"token"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid request body", nil)
+	}
+	if body.Token == "" {
+		return e.BadRequestError("token is required", nil)
+	}
+
+	provider := authenticatedProvider(e)
+	inactive := map[string]any{"active": false}
+
+	keys, err := providerKeyring(e.App, provider)
+	if err != nil {
+		return e.InternalServerError("Signing key not configured", nil)
+	}
+	claims, err := cwt.Verify(body.Token, keys, cwt.VerifyOptions{
+		Issuer:   getIssuer(),
+		Audience: provider.GetString("url"),
+		Leeway:   tokenClockSkew,
+	})
+	if err != nil || claims.ID == "" {
+		return e.JSON(200, inactive)
+	}
+
+	issued, err := e.App.FindFirstRecordByFilter(
+		"issued_tokens",
+		"jti = {:jti} && provider = {:provider}",
+		dbx.Params{"jti": claims.ID, "provider": provider.Id},
+	)
+	if err != nil || issued.GetBool("revoked") {
+		return e.JSON(200, inactive)
+	}
+
+	relay, err := e.App.FindRecordById("relays", issued.GetString("relay"))
+	if err != nil {
+		return e.JSON(200, inactive)
+	}
+	roleID, ok := currentRole(e.App, issued, relay.Id)
+	if !ok {
+		return e.JSON(200, inactive)
+	}
+	roleName := ""
+	if role, err := e.App.FindRecordById("roles", roleID); err == nil {
+		roleName = role.GetString("name")
+	}
+
+	resp := map[string]any{
+		"active":        true,
+		"token_type":    "cwt",
+		"jti":           claims.ID,
+		"iss":           claims.Issuer,
+		"sub":           claims.Subject,
+		"aud":           claims.Audience,
+		"exp":           claims.ExpiresAt.Unix(),
+		"iat":           claims.IssuedAt.Unix(),
+		"scope":         cwt.FormatScopes(claims.Scopes),
+		"relay":         relay.GetString("guid"),
+		"role":          roleName,
+		"authorization": authorizationForRole(e.App, roleID),
+	}
+	if !claims.NotBefore.IsZero() {
+		resp["nbf"] = claims.NotBefore.Unix()
+	}
+	return e.JSON(200, resp)
+}
+
+// currentRole returns the role a ledger entry's holder has on the relay now:
+// the API key's role for key-minted tokens, otherwise the user's relay role.
+func currentRole(app core.App, issued *core.Record, relayID string) (string, bool) {
+	if keyID := issued.GetString("api_key"); keyID != "" {
+		key, err := app.FindRecordById("api_keys", keyID)
+		if err != nil || !apiKeyUsable(key) || key.GetString("relay") != relayID {
+			return "", false
+		}
+		return key.GetString("role"), true
+	}
+
+	relayRole, err := app.FindFirstRecordByFilter(
+		"relay_roles",
+		"user = {:user} && relay = {:relay}",
+		dbx.Params{"user": issued.GetString("user"), "relay": relayID},
+	)
+	if err != nil {
+		return "", false
+	}
+	return relayRole.GetString("role"), true
+}
+
+// keyringForKeyID returns the keys a token with the given kid verifies
+// against: the matching self-hosted provider's key, or the control plane
+// keyring. Default providers mirror the control plane's kid, so only
+// self-hosted providers are matched, and a kid shared by several of them is
+// an error rather than a guess.
+func keyringForKeyID(app core.App, keyID string) (cwt.Keyring, error) {
+	providers, err := app.FindRecordsByFilter(
+		"providers",
+		"key_id = {:kid} && self_hosted = true",
+		"", 2, 0,
+		dbx.Params{"kid": keyID},
+	)
+	if err != nil {
+		return nil, err
+	}
+	switch len(providers) {
+	case 0:
+		return verificationKeyring(app)
+	case 1:
+		return providerKeyring(app, providers[0])
+	default:
+		return nil, fmt.Errorf("key id %q is used by several providers", keyID)
+	}
+}
+
+// providerKeyring returns the keys that tokens for provider are verified with:
+// the provider's own key when self-hosted, the control plane keyring otherwise.
+func providerKeyring(app core.App, provider *core.Record) (cwt.Keyring, error) {
+	if !provider.GetBool("self_hosted") {
+		keys, err := verificationKeyring(app)
+		if err != nil {
+			return nil, err
+		}
+		for id, key := range keys {
+			keys[id] = withProviderMACAlgorithm(key, provider)
+		}
+		return keys, nil
+	}
+	key, err := providerSigningKey(app, provider)
+	if err != nil {
+		return nil, err
+	}
+	return cwt.NewKeyring(key), nil
+}
@@ -1,15 +1,82 @@
 package routes
 
 import (
+	"errors"
+	"strings"
+	"time"
+
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 )
 
 func RegisterInvitationRoutes(se *core.ServeEvent) {
-	se.Router.POST("/api/accept-invitation", handleAcceptInvitation).Bind(apis.RequireAuth())
+	se.Router.POST("/api/accept-invitation", handleAcceptInvitation).
+		Bind(apis.RequireAuth()).
+		BindFunc(requireRateLimit(se.App, invitationRateLimits, nil))
+	se.Router.GET("/api/invitations/{key}", handlePreviewInvitation).
+		BindFunc(requireRateLimit(se.App, invitationRateLimits, nil))
 }
 
+// handlePreviewInvitation describes the relay an invitation is for, so users
+// can see what they are joining before accepting. It needs no authentication;
+// unknown and disabled keys get the same 404.
+func handlePreviewInvitation(e *core.RequestEvent) error {
+	invitation, err := e.App.FindFirstRecordByFilter(
+		"relay_invitations",
+		"key = {:key} && enabled = true",
+		dbx.Params{"key": e.Request.PathValue("key")},
+	)
+	if err != nil {
+		return e.NotFoundError("Invitation not found", nil)
+	}
+	if invitationExpired(invitation) {
+		return e.Error(410, "Invitation has expired", nil)
+	}
+	if maxUses := invitation.GetInt("max_uses"); maxUses > 0 && invitation.GetInt("use_count") >= maxUses {
+		return e.Error(410, "Invitation has reached its maximum number of uses", nil)
+	}
+
+	relay, err := e.App.FindRecordById("relays", invitation.GetString("relay"))
+	if err != nil {
+		return e.NotFoundError("Invitation not found", nil)
+	}
+	role, err := e.App.FindRecordById("roles", invitation.GetString("role"))
+	if err != nil {
+		return e.InternalServerError("Failed to load role", nil)
+	}
+	members, err := e.App.CountRecords("relay_roles", dbx.HashExp{"relay": relay.Id})
+	if err != nil {
+		return e.InternalServerError("Failed to count members", nil)
+	}
+
+	// The shared invite link has no inviter; show the relay's creator. Only
+	// the display name is shown, since anyone with the link can see it.
+	inviterID := invitation.GetString("invited_by")
+	if inviterID == "" {
+		inviterID = relay.GetString("creator")
+	}
+	var inviter string
+	if user, err := e.App.FindRecordById("users", inviterID); err == nil {
+		inviter = user.GetString("name")
+	}
+
+	return e.JSON(200, map[string]any{
+		"relay":       relay.GetString("name"),
+		"inviter":     inviter,
+		"role":        role.GetString("name"),
+		"memberCount": members,
+		"expiresAt":   invitation.GetDateTime("expires_at"),
+	})
+}
+
+var errInvitationUsedUp = errors.New("invitation has no uses left")
+
+// handleAcceptInvitation adds the caller to an invitation's relay. Expired
+// invitations and ones that reached max_uses are refused; each redemption is
+// counted and logged in invitation_redemptions. Emailed invitations can only
+// be accepted from the invited, verified address, and joining needs a free
+// seat on the relay.
 func handleAcceptInvitation(e *core.RequestEvent) error {
 	var body struct {
 		Key string `json:"key"`
@@ -26,6 +93,17 @@ func handleAcceptInvitation(e *core.RequestEvent) error {
 	if err != nil {
 		return e.NotFoundError("Invitation not found", nil)
 	}
+	if invitationExpired(invitation) {
+		return e.Error(410, "Invitation has expired", nil)
+	}
+	if email := invitation.GetString("email"); email != "" {
+		if !strings.EqualFold(e.Auth.Email(), email) {
+			return e.ForbiddenError("This invitation was sent to a different email address", nil)
+		}
+		if !e.Auth.Verified() {
+			return e.ForbiddenError("Verify your email address to accept this invitation", nil)
+		}
+	}
 
 	relayID := invitation.GetString("relay")
 	userID := e.Auth.Id
@@ -40,17 +118,61 @@ func handleAcceptInvitation(e *core.RequestEvent) error {
 		return e.Error(409, "Already a member of this relay", nil)
 	}
 
-	// Create relay_role
-	relayRolesCol, err := e.App.FindCollectionByNameOrId("relay_roles")
-	if err != nil {
-		return e.InternalServerError("Collection not found", nil)
-	}
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		// Re-read inside the transaction so concurrent redemptions can't
+		// exceed max_uses.
+		inv, err := txApp.FindRecordById("relay_invitations", invitation.Id)
+		if err != nil {
+			return err
+		}
+		if maxUses := inv.GetInt("max_uses"); maxUses > 0 && inv.GetInt("use_count") >= maxUses {
+			return errInvitationUsedUp
+		}
+
+		relay, err := txApp.FindRecordById("relays", relayID)
+		if err != nil {
+			return err
+		}
+		if err := ensureSeatAvailable(txApp, relay, inv.GetString("role")); err != nil {
+			return err
+		}
+
+		// Create relay_role
+		relayRolesCol, err := txApp.FindCollectionByNameOrId("relay_roles")
+		if err != nil {
+			return err
+		}
+		role := core.NewRecord(relayRolesCol)
+		role.Set("user", userID)
+		role.Set("role", inv.GetString("role"))
+		role.Set("relay", relayID)
+		if err := txApp.Save(role); err != nil {
+			return err
+		}
 
-	role := core.NewRecord(relayRolesCol)
-	role.Set("user", userID)
-	role.Set("role", invitation.GetString("role"))
-	role.Set("relay", relayID)
-	if err := e.App.Save(role); err != nil {
+		inv.Set("use_count+", 1)
+		if err := txApp.Save(inv); err != nil {
+			return err
+		}
+
+		redemptionsCol, err := txApp.FindCollectionByNameOrId("invitation_redemptions")
+		if err != nil {
+			return err
+		}
+		redemption := core.NewRecord(redemptionsCol)
+		redemption.Set("invitation", inv.Id)
+		redemption.Set("relay", relayID)
+		redemption.Set("user", userID)
+		redemption.Set("role", inv.GetString("role"))
+		return txApp.Save(redemption)
+	})
+	if errors.Is(err, errInvitationUsedUp) {
+		return e.Error(410, "Invitation has reached its maximum number of uses", nil)
+	}
+	if errors.Is(err, errNoSeats) {
+		return seatLimitError(e)
+	}
+	if err != nil {
 		return e.InternalServerError("Failed to create role", nil)
 	}
 
@@ -64,3 +186,9 @@ func handleAcceptInvitation(e *core.RequestEvent) error {
 
 	return e.JSON(200, relay)
 }
+
+// invitationExpired reports whether an invitation's expires_at has passed.
+func invitationExpired(invitation *core.Record) bool {
+	expiresAt := invitation.GetDateTime("expires_at")
+	return !expiresAt.IsZero() && !expiresAt.Time().After(time.Now())
+}
@@ -0,0 +1,273 @@
+package routes
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"relay-control-plane/cwt"
+)
+
+// keyRetireGrace is how long a retired key keeps verifying tokens, so that
+// tokens signed just before a rotation can still be used, and refreshed,
+// until they expire.
+const keyRetireGrace = maxTokenTTL*time.Second + tokenRefreshGrace
+
+func RegisterKeyringRoutes(se *core.ServeEvent) {
+	g := se.Router.Group("/api/keys")
+	g.Bind(apis.RequireSuperuserAuth())
+	g.GET("", handleListKeys)
+	g.POST("", handleStageKey)
+	g.POST("/{kid}/activate", handleActivateKey)
+	g.POST("/{kid}/retire", handleRetireKey)
+}
+
+// BootstrapSigningKeys imports the environment signing key as the active key
+// when the keyring is empty, so existing deployments keep their key id.
+func BootstrapSigningKeys(app core.App) error {
+	total, err := app.CountRecords("signing_keys")
+	if err != nil || total > 0 {
+		return err
+	}
+
+	key, err := getSigningKey()
+	if err != nil {
+		return nil // no environment key configured
+	}
+
+	rec, err := newSigningKeyRecord(app, key)
+	if err != nil {
+		return err
+	}
+	rec.Set("status", "active")
+	rec.Set("valid_from", time.Now())
+	return app.Save(rec)
+}
+
+func handleListKeys(e *core.RequestEvent) error {
+	records, err := e.App.FindRecordsByFilter("signing_keys", "", "-created", 0, 0)
+	if err != nil {
+		return e.InternalServerError("Failed to load keys", nil)
+	}
+	return e.JSON(200, records)
+}
+
+func handleStageKey(e *core.RequestEvent) error {
+	var body struct {
+		KeyID   string `json:"keyId"`
+		KeyType string `json:"keyType"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid request body", nil)
+	}
+
+	keyType, err := cwt.ParseKeyType(body.KeyType)
+	if err != nil {
+		return e.BadRequestError("Unsupported key type", nil)
+	}
+	if body.KeyID == "" {
+		body.KeyID = fmt.Sprintf("key_%d", time.Now().Unix())
+	}
+
+	if _, err := findSigningKeyRecord(e.App, body.KeyID); err == nil {
+		return e.Error(409, "Key id already exists", nil)
+	}
+
+	key, err := cwt.GenerateKey(body.KeyID, keyType)
+	if err != nil {
+		return e.InternalServerError("Failed to generate key", nil)
+	}
+
+	rec, err := newSigningKeyRecord(e.App, key)
+	if err != nil {
+		return e.InternalServerError("Failed to encode key", nil)
+	}
+	rec.Set("status", "staged")
+	if err := e.App.Save(rec); err != nil {
+		return e.InternalServerError("Failed to save key", nil)
+	}
+
+	return e.JSON(200, rec)
+}
+
+func handleActivateKey(e *core.RequestEvent) error {
+	rec, err := findSigningKeyRecord(e.App, e.Request.PathValue("kid"))
+	if err != nil {
+		return e.NotFoundError("Key not found", nil)
+	}
+	if rec.GetString("status") != "staged" {
+		return e.BadRequestError("Only staged keys can be activated", nil)
+	}
+
+	now := time.Now()
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		active, err := txApp.FindRecordsByFilter("signing_keys", "status = 'active'", "", 0, 0)
+		if err != nil {
+			return err
+		}
+		for _, prev := range active {
+			prev.Set("status", "retired")
+			prev.Set("valid_until", now.Add(keyRetireGrace))
+			if err := txApp.Save(prev); err != nil {
+				return err
+			}
+		}
+
+		rec.Set("status", "active")
+		rec.Set("valid_from", now)
+		if err := txApp.Save(rec); err != nil {
+			return err
+		}
+
+		return syncDefaultProviders(txApp, rec)
+	})
+	if err != nil {
+		return e.InternalServerError("Failed to activate key", nil)
+	}
+
+	return e.JSON(200, rec)
+}
+
+func handleRetireKey(e *core.RequestEvent) error {
+	var body struct {
+		ValidUntil string `json:"validUntil"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid request body", nil)
+	}
+
+	rec, err := findSigningKeyRecord(e.App, e.Request.PathValue("kid"))
+	if err != nil {
+		return e.NotFoundError("Key not found", nil)
+	}
+	if rec.GetString("status") == "active" {
+		return e.BadRequestError("Activate another key before retiring the active key", nil)
+	}
+
+	validUntil := time.Now().Add(keyRetireGrace)
+	if body.ValidUntil != "" {
+		dt, err := types.ParseDateTime(body.ValidUntil)
+		if err != nil {
+			return e.BadRequestError("Invalid validUntil", nil)
+		}
+		validUntil = dt.Time()
+	}
+
+	rec.Set("status", "retired")
+	rec.Set("valid_until", validUntil)
+	if err := e.App.Save(rec); err != nil {
+		return e.InternalServerError("Failed to retire key", nil)
+	}
+
+	return e.JSON(200, rec)
+}
+
+// activeSigningKey returns the keyring's active key, falling back to the
+// environment key when the keyring has none.
+func activeSigningKey(app core.App) (cwt.Key, error) {
+	rec, err := app.FindFirstRecordByFilter("signing_keys", "status = 'active'")
+	if err != nil {
+		return getSigningKey()
+	}
+	return signingKeyFromRecord(rec)
+}
+
+// validSigningKeys returns keys relays should currently accept: staged and
+// active keys, plus retired keys still inside their validity window.
+func validSigningKeys(app core.App) ([]cwt.Key, error) {
+	records, err := app.FindRecordsByFilter(
+		"signing_keys",
+		"status = 'staged' || status = 'active' || (status = 'retired' && valid_until > {:now})",
+		"-created", 0, 0,
+		dbx.Params{"now": types.NowDateTime().String()},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]cwt.Key, 0, len(records))
+	for _, rec := range records {
+		key, err := signingKeyFromRecord(rec)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		if key, err := getSigningKey(); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// verificationKeyring returns a cwt.Keyring of all currently valid keys.
+func verificationKeyring(app core.App) (cwt.Keyring, error) {
+	keys, err := validSigningKeys(app)
+	if err != nil {
+		return nil, err
+	}
+	return cwt.NewKeyring(keys...), nil
+}
+
+func findSigningKeyRecord(app core.App, keyID string) (*core.Record, error) {
+	return app.FindFirstRecordByFilter("signing_keys", "key_id = {:kid}", dbx.Params{"kid": keyID})
+}
+
+func newSigningKeyRecord(app core.App, key cwt.Key) (*core.Record, error) {
+	col, err := app.FindCollectionByNameOrId("signing_keys")
+	if err != nil {
+		return nil, err
+	}
+	private, err := key.MarshalPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := recordPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := core.NewRecord(col)
+	rec.Set("key_id", key.ID)
+	rec.Set("key_type", string(key.Type))
+	rec.Set("private_key", base64.StdEncoding.EncodeToString(private))
+	rec.Set("public_key", publicKey)
+	return rec, nil
+}
+
+func signingKeyFromRecord(rec *core.Record) (cwt.Key, error) {
+	keyType, err := cwt.ParseKeyType(rec.GetString("key_type"))
+	if err != nil {
+		return cwt.Key{}, err
+	}
+	der, err := base64.StdEncoding.DecodeString(rec.GetString("private_key"))
+	if err != nil {
+		return cwt.Key{}, err
+	}
+	return cwt.ParsePrivateKey(rec.GetString("key_id"), keyType, der)
+}
+
+// syncDefaultProviders points the non-self-hosted providers at the newly
+// activated key so their records describe the key tokens are signed with.
+func syncDefaultProviders(app core.App, keyRec *core.Record) error {
+	providers, err := app.FindRecordsByFilter("providers", "self_hosted = false", "", 0, 0)
+	if err != nil {
+		return err
+	}
+	for _, p := range providers {
+		p.Set("key_id", keyRec.GetString("key_id"))
+		p.Set("key_type", keyRec.GetString("key_type"))
+		p.Set("public_key", keyRec.GetString("public_key"))
+		if err := app.Save(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"bytes"
+	"html/template"
+	"net/mail"
+	"os"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+)
+
+// sendTemplatedEmail renders an HTML template from templates/ and sends it
+// with the app mailer, from the sender configured in the app settings.
+func sendTemplatedEmail(app core.App, templatePath string, to mail.Address, subject string, data any) error {
+	tmplBytes, err := os.ReadFile(templatePath)
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New(templatePath).Parse(string(tmplBytes))
+	if err != nil {
+		return err
+	}
+
+	var html bytes.Buffer
+	if err := tmpl.Execute(&html, data); err != nil {
+		return err
+	}
+
+	meta := app.Settings().Meta
+	return app.NewMailClient().Send(&mailer.Message{
+		From:    mail.Address{Name: meta.SenderName, Address: meta.SenderAddress},
+		To:      []mail.Address{to},
+		Subject: subject,
+		HTML:    html.String(),
+	})
+}
@@ -0,0 +1,175 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+var (
+	errLastOwner        = errors.New("relay must keep at least one owner")
+	errRoleNotGrantable = errors.New("role has capabilities the caller lacks")
+)
+
+func RegisterMemberRoutes(se *core.ServeEvent) {
+	g := se.Router.Group("/api/relays/{relay}")
+	g.Bind(apis.RequireAuth())
+	g.PATCH("/members/{user}", handleUpdateMember)
+	g.DELETE("/members/{user}", handleRemoveMember)
+	g.POST("/leave", handleLeaveRelay)
+}
+
+// handleUpdateMember changes a member's role. The caller needs
+// manage_members and every capability of both the old and the new role.
+func handleUpdateMember(e *core.RequestEvent) error {
+	relay, err := relayWithCapability(e, capManageMembers, "Not allowed to manage members of this relay")
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid request body", nil)
+	}
+	if _, err := e.App.FindRecordById("roles", body.Role); err != nil {
+		return e.BadRequestError("Unknown role", nil)
+	}
+
+	var membership *core.Record
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		membership, err = findMembership(txApp, relay.Id, e.Request.PathValue("user"))
+		if err != nil {
+			return err
+		}
+		current := membership.GetString("role")
+		if !canGrantRole(txApp, e.Auth.Id, relay.Id, current) || !canGrantRole(txApp, e.Auth.Id, relay.Id, body.Role) {
+			return errRoleNotGrantable
+		}
+		if roleHasCapability(txApp, current, capDeleteRelay) && !roleHasCapability(txApp, body.Role, capDeleteRelay) {
+			if err := ensureAnotherOwner(txApp, relay.Id); err != nil {
+				return err
+			}
+		}
+		if !roleTakesSeat(txApp, current) {
+			if err := ensureSeatAvailable(txApp, relay, body.Role); err != nil {
+				return err
+			}
+		}
+		membership.Set("role", body.Role)
+		return txApp.Save(membership)
+	})
+	if err != nil {
+		return memberError(e, err, "Failed to update member")
+	}
+
+	return e.JSON(200, membership)
+}
+
+// handleRemoveMember removes a member from a relay. The caller needs
+// manage_members and every capability of the member's role.
+func handleRemoveMember(e *core.RequestEvent) error {
+	relay, err := relayWithCapability(e, capManageMembers, "Not allowed to manage members of this relay")
+	if err != nil {
+		return err
+	}
+
+	userID := e.Request.PathValue("user")
+	if membership, err := findMembership(e.App, relay.Id, userID); err == nil &&
+		!canGrantRole(e.App, e.Auth.Id, relay.Id, membership.GetString("role")) {
+		return roleNotGrantableError(e)
+	}
+
+	if err := removeMember(e.App, relay.Id, userID); err != nil {
+		return memberError(e, err, "Failed to remove member")
+	}
+	return e.NoContent(204)
+}
+
+// handleLeaveRelay removes the caller from a relay.
+func handleLeaveRelay(e *core.RequestEvent) error {
+	relay, err := findRelay(e.App, e.Request.PathValue("relay"))
+	if err != nil {
+		return e.NotFoundError("Relay not found", nil)
+	}
+
+	if err := removeMember(e.App, relay.Id, e.Auth.Id); err != nil {
+		return memberError(e, err, "Failed to leave relay")
+	}
+	return e.NoContent(204)
+}
+
+// removeMember deletes a user's relay_roles entry along with their roles on
+// the relay's shared folders. Deleting the membership revokes the user's
+// tokens and the API keys they created (see onRelayRoleDelete).
+func removeMember(app core.App, relayID string, userID string) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		membership, err := findMembership(txApp, relayID, userID)
+		if err != nil {
+			return err
+		}
+		if roleHasCapability(txApp, membership.GetString("role"), capDeleteRelay) {
+			if err := ensureAnotherOwner(txApp, relayID); err != nil {
+				return err
+			}
+		}
+
+		folderRoles, err := txApp.FindRecordsByFilter(
+			"shared_folder_roles",
+			"user = {:user} && shared_folder.relay = {:relay}",
+			"", 0, 0,
+			dbx.Params{"user": userID, "relay": relayID},
+		)
+		if err != nil {
+			return err
+		}
+		for _, r := range folderRoles {
+			if err := txApp.Delete(r); err != nil {
+				return err
+			}
+		}
+
+		return txApp.Delete(membership)
+	})
+}
+
+func findMembership(app core.App, relayID string, userID string) (*core.Record, error) {
+	return app.FindFirstRecordByFilter(
+		"relay_roles",
+		"user = {:user} && relay = {:relay}",
+		dbx.Params{"user": userID, "relay": relayID},
+	)
+}
+
+// ensureAnotherOwner returns errLastOwner unless more than one member's role
+// grants delete_relay, so the caller can demote or remove one of them.
+func ensureAnotherOwner(app core.App, relayID string) error {
+	owners, err := relayMembersWithCapability(app, relayID, capDeleteRelay)
+	if err != nil {
+		return err
+	}
+	if len(owners) < 2 {
+		return errLastOwner
+	}
+	return nil
+}
+
+// memberError maps membership errors to HTTP errors.
+func memberError(e *core.RequestEvent, err error, message string) error {
+	switch {
+	case errors.Is(err, errNoSeats):
+		return seatLimitError(e)
+	case errors.Is(err, errRoleNotGrantable):
+		return roleNotGrantableError(e)
+	case errors.Is(err, errLastOwner):
+		return e.Error(409, "Cannot remove or demote the last owner of a relay", nil)
+	case errors.Is(err, sql.ErrNoRows):
+		return e.NotFoundError("Member not found", nil)
+	default:
+		return e.InternalServerError(message, nil)
+	}
+}
@@ -0,0 +1,187 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ownershipTransferTTL is how long a nominee has to accept a transfer.
+const ownershipTransferTTL = 7 * 24 * time.Hour
+
+var errTransferStale = errors.New("ownership transfer no longer applies")
+
+func RegisterOwnershipTransferRoutes(se *core.ServeEvent) {
+	g := se.Router.Group("/api/relays/{relay}/transfer")
+	g.Bind(apis.RequireAuth())
+	g.POST("", handleCreateOwnershipTransfer)
+	g.POST("/accept", handleAcceptOwnershipTransfer)
+	g.POST("/cancel", handleCancelOwnershipTransfer)
+
+	se.App.Cron().MustAdd("deleteExpiredOwnershipTransfers", "0 * * * *", func() {
+		if err := deleteExpiredOwnershipTransfers(se.App); err != nil {
+			se.App.Logger().Error("Failed to delete expired ownership transfers", "error", err)
+		}
+	})
+}
+
+// handleCreateOwnershipTransfer nominates another member as the relay's new
+// owner. It replaces any pending transfer for the relay.
+func handleCreateOwnershipTransfer(e *core.RequestEvent) error {
+	relay, err := relayWithCapability(e, capDeleteRelay, "Only relay owners can transfer ownership")
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		User string `json:"user"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid request body", nil)
+	}
+	if body.User == "" || body.User == e.Auth.Id {
+		return e.BadRequestError("user must be another member of the relay", nil)
+	}
+	if _, err := findMembership(e.App, relay.Id, body.User); err != nil {
+		return e.BadRequestError("user must be another member of the relay", nil)
+	}
+
+	col, err := e.App.FindCollectionByNameOrId("ownership_transfers")
+	if err != nil {
+		return e.InternalServerError("Collection not found", nil)
+	}
+
+	transfer := core.NewRecord(col)
+	transfer.Set("relay", relay.Id)
+	transfer.Set("from", e.Auth.Id)
+	transfer.Set("to", body.User)
+	transfer.Set("expires_at", time.Now().Add(ownershipTransferTTL))
+
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		if pending, err := findOwnershipTransfer(txApp, relay.Id); err == nil {
+			if err := txApp.Delete(pending); err != nil {
+				return err
+			}
+		}
+		return txApp.Save(transfer)
+	})
+	if err != nil {
+		return e.InternalServerError("Failed to create ownership transfer", nil)
+	}
+
+	return e.JSON(200, transfer)
+}
+
+// handleAcceptOwnershipTransfer completes a transfer. The nominee becomes an
+// Owner and the relay's creator; the nominating owner becomes a Member.
+func handleAcceptOwnershipTransfer(e *core.RequestEvent) error {
+	relay, err := findRelay(e.App, e.Request.PathValue("relay"))
+	if err != nil {
+		return e.NotFoundError("Relay not found", nil)
+	}
+
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		transfer, err := findOwnershipTransfer(txApp, relay.Id)
+		if err != nil {
+			return err
+		}
+		if transfer.GetString("to") != e.Auth.Id {
+			return sql.ErrNoRows
+		}
+		if transfer.GetDateTime("expires_at").Time().Before(time.Now()) {
+			return errTransferStale
+		}
+
+		fromID := transfer.GetString("from")
+		if !hasRelayCapability(txApp, fromID, relay.Id, capDeleteRelay) {
+			return errTransferStale
+		}
+		from, err := findMembership(txApp, relay.Id, fromID)
+		if err != nil {
+			return errTransferStale
+		}
+		to, err := findMembership(txApp, relay.Id, e.Auth.Id)
+		if err != nil {
+			return errTransferStale
+		}
+
+		to.Set("role", ownerRoleID)
+		if err := txApp.Save(to); err != nil {
+			return err
+		}
+		from.Set("role", memberRoleID)
+		if err := txApp.Save(from); err != nil {
+			return err
+		}
+		relay.Set("creator", e.Auth.Id)
+		if err := txApp.Save(relay); err != nil {
+			return err
+		}
+		return txApp.Delete(transfer)
+	})
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return e.NotFoundError("No pending ownership transfer for you on this relay", nil)
+	case errors.Is(err, errTransferStale):
+		return e.Error(410, "Ownership transfer has expired or no longer applies", nil)
+	case err != nil:
+		return e.InternalServerError("Failed to transfer ownership", nil)
+	}
+
+	apis.EnrichRecord(e, relay, "relay_roles_via_relay")
+	return e.JSON(200, relay)
+}
+
+// handleCancelOwnershipTransfer withdraws or declines a pending transfer.
+// Relay owners and the nominee may cancel it.
+func handleCancelOwnershipTransfer(e *core.RequestEvent) error {
+	relay, err := findRelay(e.App, e.Request.PathValue("relay"))
+	if err != nil {
+		return e.NotFoundError("Relay not found", nil)
+	}
+
+	transfer, err := findOwnershipTransfer(e.App, relay.Id)
+	if err != nil {
+		return e.NotFoundError("No pending ownership transfer on this relay", nil)
+	}
+	if transfer.GetString("to") != e.Auth.Id && !hasRelayCapability(e.App, e.Auth.Id, relay.Id, capDeleteRelay) {
+		return e.ForbiddenError("Not allowed to cancel this ownership transfer", nil)
+	}
+
+	if err := e.App.Delete(transfer); err != nil {
+		return e.InternalServerError("Failed to cancel ownership transfer", nil)
+	}
+	return e.NoContent(204)
+}
+
+func findOwnershipTransfer(app core.App, relayID string) (*core.Record, error) {
+	return app.FindFirstRecordByFilter(
+		"ownership_transfers",
+		"relay = {:relay}",
+		dbx.Params{"relay": relayID},
+	)
+}
+
+// deleteExpiredOwnershipTransfers removes transfers that were never accepted.
+func deleteExpiredOwnershipTransfers(app core.App) error {
+	expired, err := app.FindRecordsByFilter(
+		"ownership_transfers",
+		"expires_at <= {:now}",
+		"", 0, 0,
+		dbx.Params{"now": types.NowDateTime().String()},
+	)
+	if err != nil {
+		return err
+	}
+	for _, transfer := range expired {
+		if err := app.Delete(transfer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
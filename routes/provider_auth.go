@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"crypto/subtle"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const providerContextKey = "provider"
+
+// requireProviderAuth authenticates relay servers using HTTP Basic auth with
+// the provider's record ID as username and its api_secret as password. The
+// key_id can't be used: default providers share the control plane's kid,
+// and it changes whenever a signing key is activated.
+// The matching provider record is stored on the request under providerContextKey.
+func requireProviderAuth(e *core.RequestEvent) error {
+	providerID, secret, ok := e.Request.BasicAuth()
+	if !ok || providerID == "" || secret == "" {
+		return e.UnauthorizedError("Provider credentials required", nil)
+	}
+
+	provider, err := e.App.FindRecordById("providers", providerID)
+	if err != nil {
+		return e.UnauthorizedError("Invalid provider credentials", nil)
+	}
+
+	expected := provider.GetString("api_secret")
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(secret)) != 1 {
+		return e.UnauthorizedError("Invalid provider credentials", nil)
+	}
+
+	e.Set(providerContextKey, provider)
+	return e.Next()
+}
+
+// authenticatedProvider returns the provider set by requireProviderAuth.
+func authenticatedProvider(e *core.RequestEvent) *core.Record {
+	provider, _ := e.Get(providerContextKey).(*core.Record)
+	return provider
+}
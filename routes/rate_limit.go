@@ -0,0 +1,267 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	rateLimiterStoreKey       = "relayRateLimiter"
+	rateLimitPoliciesStoreKey = "relayRateLimitPolicies"
+)
+
+// rateLimit is a token bucket: up to Burst requests at once, refilled at a
+// rate of Burst per Period. A zero Burst disables the limit.
+type rateLimit struct {
+	Burst  int
+	Period time.Duration
+}
+
+func (l rateLimit) enabled() bool {
+	return l.Burst > 0 && l.Period > 0
+}
+
+// rateLimitPolicy holds the limits for one group of routes. Each request is
+// counted against the caller (user or API key) and the client IP by
+// requireRateLimit, and against the relay by takeRelayRateLimit once the
+// handler has resolved it.
+type rateLimitPolicy struct {
+	Name  string
+	User  rateLimit
+	IP    rateLimit
+	Relay rateLimit
+}
+
+var (
+	tokenRateLimits = rateLimitPolicy{
+		Name:  "token",
+		User:  rateLimit{Burst: 60, Period: time.Minute},
+		IP:    rateLimit{Burst: 120, Period: time.Minute},
+		Relay: rateLimit{Burst: 600, Period: time.Minute},
+	}
+	invitationRateLimits = rateLimitPolicy{
+		Name: "invitation",
+		User: rateLimit{Burst: 10, Period: time.Minute},
+		IP:   rateLimit{Burst: 20, Period: time.Minute},
+	}
+	accessRequestRateLimits = rateLimitPolicy{
+		Name: "access_request",
+		User: rateLimit{Burst: 5, Period: time.Hour},
+		IP:   rateLimit{Burst: 20, Period: time.Hour},
+	}
+	checkHostRateLimits = rateLimitPolicy{
+		Name:  "check_host",
+		User:  rateLimit{Burst: 30, Period: time.Minute},
+		IP:    rateLimit{Burst: 60, Period: time.Minute},
+		Relay: rateLimit{Burst: 30, Period: time.Minute},
+	}
+)
+
+// requireRateLimit returns middleware enforcing the user and IP limits of
+// policy. costOf returns how many tokens a request consumes and may be nil
+// for one per request. Limits can be overridden with
+// RELAY_RATE_LIMIT_<POLICY>_<USER|IP|RELAY>, e.g.
+// RELAY_RATE_LIMIT_TOKEN_USER=30/1m; "off" disables a limit.
+//
+// It must run after authentication so the caller is known.
+func requireRateLimit(app core.App, policy rateLimitPolicy, costOf func(*core.RequestEvent) int) func(*core.RequestEvent) error {
+	policy = policy.fromEnv(app)
+	appRateLimitPolicies(app).Store(policy.Name, policy)
+
+	return func(e *core.RequestEvent) error {
+		var checks []rateLimitCheck
+		if subject := rateLimitSubject(e); subject != "" {
+			checks = append(checks, rateLimitCheck{policy.Name + ":user:" + subject, policy.User})
+		}
+		checks = append(checks, rateLimitCheck{policy.Name + ":ip:" + e.RealIP(), policy.IP})
+
+		cost := 1
+		if costOf != nil {
+			cost = costOf(e)
+		}
+		if err := takeRateLimit(e, checks, cost); err != nil {
+			return err
+		}
+		return e.Next()
+	}
+}
+
+// takeRelayRateLimit charges cost tokens to the relay's bucket of policy.
+// Handlers call it after resolving the relay and checking the caller's
+// access to it, so the bucket is keyed on the relay record ID however the
+// client named the relay, and callers without access can't drain it.
+func takeRelayRateLimit(e *core.RequestEvent, policy rateLimitPolicy, relayID string, cost int) error {
+	if p, ok := appRateLimitPolicies(e.App).Load(policy.Name); ok {
+		policy = p.(rateLimitPolicy)
+	}
+	return takeRateLimit(e, []rateLimitCheck{{policy.Name + ":relay:" + relayID, policy.Relay}}, cost)
+}
+
+// takeRateLimit consumes cost tokens from every bucket in checks and returns
+// a 429 with Retry-After if any of them is short, or a 400 if cost is more
+// than a bucket can ever hold.
+func takeRateLimit(e *core.RequestEvent, checks []rateLimitCheck, cost int) error {
+	wait, err := appRateLimiter(e.App).take(time.Now(), checks, cost)
+	if err != nil {
+		return e.BadRequestError("Request exceeds the rate limit, send fewer items at once", nil)
+	}
+	if wait > 0 {
+		e.Response.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return e.TooManyRequestsError("Too many requests, try again later", nil)
+	}
+	return nil
+}
+
+// rateLimitSubject identifies the caller for the per-user limit.
+func rateLimitSubject(e *core.RequestEvent) string {
+	if key := requestAPIKey(e); key != nil {
+		return apiKeySubject(key)
+	}
+	if e.Auth != nil {
+		return e.Auth.Id
+	}
+	return ""
+}
+
+// fromEnv applies RELAY_RATE_LIMIT_* overrides. Invalid values are logged and
+// the default is kept.
+func (p rateLimitPolicy) fromEnv(app core.App) rateLimitPolicy {
+	for name, limit := range map[string]*rateLimit{"USER": &p.User, "IP": &p.IP, "RELAY": &p.Relay} {
+		env := "RELAY_RATE_LIMIT_" + strings.ToUpper(p.Name) + "_" + name
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := parseRateLimit(value)
+		if err != nil {
+			app.Logger().Warn("Ignoring invalid rate limit", "env", env, "value", value, "error", err)
+			continue
+		}
+		*limit = parsed
+	}
+	return p
+}
+
+// parseRateLimit parses "<burst>/<period>", e.g. "60/1m". "off" and "0"
+// disable the limit.
+func parseRateLimit(value string) (rateLimit, error) {
+	if value == "off" || value == "0" {
+		return rateLimit{}, nil
+	}
+	burstStr, periodStr, ok := strings.Cut(value, "/")
+	if !ok {
+		return rateLimit{}, fmt.Errorf("expected <burst>/<period>")
+	}
+	burst, err := strconv.Atoi(burstStr)
+	if err != nil || burst < 0 {
+		return rateLimit{}, fmt.Errorf("invalid burst %q", burstStr)
+	}
+	period, err := time.ParseDuration(periodStr)
+	if err != nil || period <= 0 {
+		return rateLimit{}, fmt.Errorf("invalid period %q", periodStr)
+	}
+	return rateLimit{Burst: burst, Period: period}, nil
+}
+
+type rateLimitCheck struct {
+	key   string
+	limit rateLimit
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	period time.Duration
+}
+
+// rateLimiter keeps in-memory token buckets. Limits are per process; each
+// instance behind a load balancer counts separately.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func appRateLimiter(app core.App) *rateLimiter {
+	return app.Store().GetOrSet(rateLimiterStoreKey, func() any {
+		return &rateLimiter{buckets: map[string]*tokenBucket{}}
+	}).(*rateLimiter)
+}
+
+// appRateLimitPolicies holds the policies bound by requireRateLimit, with
+// their environment overrides applied, by name.
+func appRateLimitPolicies(app core.App) *sync.Map {
+	return app.Store().GetOrSet(rateLimitPoliciesStoreKey, func() any {
+		return &sync.Map{}
+	}).(*sync.Map)
+}
+
+// errRateLimitCost is returned by take when the cost is more than a bucket's
+// burst, so the request could never be allowed.
+var errRateLimitCost = errors.New("cost exceeds rate limit burst")
+
+// take consumes cost tokens from every bucket in checks, or from none if any
+// of them is short. It returns how long to wait before retrying, or 0 if the
+// request is allowed.
+func (l *rateLimiter) take(now time.Time, checks []rateLimitCheck, cost int) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	n := float64(max(cost, 1))
+	for _, c := range checks {
+		if c.limit.enabled() && n > float64(c.limit.Burst) {
+			return 0, errRateLimitCost
+		}
+	}
+
+	var wait time.Duration
+	buckets := make([]*tokenBucket, 0, len(checks))
+	for _, c := range checks {
+		if !c.limit.enabled() {
+			continue
+		}
+		b := l.buckets[c.key]
+		if b == nil {
+			b = &tokenBucket{tokens: float64(c.limit.Burst), last: now, period: c.limit.Period}
+			l.buckets[c.key] = b
+		}
+		rate := float64(c.limit.Burst) / c.limit.Period.Seconds()
+		b.tokens = math.Min(float64(c.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+		b.last = now
+		if b.tokens < n {
+			wait = max(wait, time.Duration((n-b.tokens)/rate*float64(time.Second)))
+		}
+		buckets = append(buckets, b)
+	}
+	if wait > 0 {
+		return wait, nil
+	}
+	for _, b := range buckets {
+		b.tokens -= n
+	}
+	return 0, nil
+}
+
+// sweep drops buckets that have been idle long enough to be full again, so
+// the map doesn't grow with every user and IP ever seen.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= b.period {
+			delete(l.buckets, key)
+		}
+	}
+}
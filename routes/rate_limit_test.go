@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want rateLimit
+	}{
+		{"60/1m", rateLimit{Burst: 60, Period: time.Minute}},
+		{"5/1h", rateLimit{Burst: 5, Period: time.Hour}},
+		{"1/30s", rateLimit{Burst: 1, Period: 30 * time.Second}},
+		{"0/1m", rateLimit{Burst: 0, Period: time.Minute}},
+		{"off", rateLimit{}},
+		{"0", rateLimit{}},
+	}
+	for _, tt := range tests {
+		got, err := parseRateLimit(tt.in)
+		if err != nil {
+			t.Fatalf("parseRateLimit(%q) failed: %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("parseRateLimit(%q): expected %+v, got %+v", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestParseRateLimit_Invalid(t *testing.T) {
+	for _, in := range []string{"", "60", "60/", "/1m", "x/1m", "-1/1m", "60/x", "60/0s", "60/-1m"} {
+		if _, err := parseRateLimit(in); err == nil {
+			t.Errorf("parseRateLimit(%q): expected error", in)
+		}
+	}
+}
+
+func TestRateLimiterTake(t *testing.T) {
+	perMinute := func(burst int) rateLimit { return rateLimit{Burst: burst, Period: time.Minute} }
+
+	tests := []struct {
+		name     string
+		limits   []rateLimit
+		costs    []int         // consumed in order, all at the start time
+		after    time.Duration // when the final take happens
+		cost     int
+		wantWait time.Duration
+	}{
+		{"within burst", []rateLimit{perMinute(3)}, []int{1, 1}, 0, 1, 0},
+		{"burst exhausted", []rateLimit{perMinute(3)}, []int{1, 1, 1}, 0, 1, 20 * time.Second},
+		{"refilled", []rateLimit{perMinute(3)}, []int{3}, 20 * time.Second, 1, 0},
+		{"partly refilled", []rateLimit{perMinute(3)}, []int{3}, 10 * time.Second, 1, 10 * time.Second},
+		{"cost above remaining", []rateLimit{perMinute(10)}, []int{8}, 0, 5, 18 * time.Second},
+		{"cost equal to burst", []rateLimit{perMinute(10)}, nil, 0, 10, 0},
+		{"zero cost counts as one", []rateLimit{perMinute(1)}, []int{0}, 0, 0, time.Minute},
+		{"disabled limit", []rateLimit{{}}, []int{100}, 0, 100, 0},
+		{"longest wait wins", []rateLimit{perMinute(2), perMinute(4)}, []int{2}, 0, 2, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &rateLimiter{buckets: map[string]*tokenBucket{}}
+			checks := make([]rateLimitCheck, len(tt.limits))
+			for i, limit := range tt.limits {
+				checks[i] = rateLimitCheck{key: string(rune('a' + i)), limit: limit}
+			}
+
+			start := time.Now()
+			for _, cost := range tt.costs {
+				if wait, err := l.take(start, checks, cost); err != nil || wait != 0 {
+					t.Fatalf("setup take(%d): wait %v, err %v", cost, wait, err)
+				}
+			}
+			wait, err := l.take(start.Add(tt.after), checks, tt.cost)
+			if err != nil {
+				t.Fatalf("take(%d) failed: %v", tt.cost, err)
+			}
+			if diff := wait - tt.wantWait; diff < -time.Millisecond || diff > time.Millisecond {
+				t.Errorf("take(%d): expected wait %v, got %v", tt.cost, tt.wantWait, wait)
+			}
+		})
+	}
+}
+
+func TestRateLimiterTake_AllOrNothing(t *testing.T) {
+	l := &rateLimiter{buckets: map[string]*tokenBucket{}}
+	now := time.Now()
+	user := rateLimitCheck{key: "user", limit: rateLimit{Burst: 5, Period: time.Minute}}
+	relay := rateLimitCheck{key: "relay", limit: rateLimit{Burst: 1, Period: time.Minute}}
+
+	if wait, _ := l.take(now, []rateLimitCheck{relay}, 1); wait != 0 {
+		t.Fatalf("expected first relay take to pass, waited %v", wait)
+	}
+	if wait, _ := l.take(now, []rateLimitCheck{user, relay}, 1); wait == 0 {
+		t.Fatal("expected take to be limited by the empty relay bucket")
+	}
+	if got := l.buckets["user"].tokens; got != 5 {
+		t.Errorf("expected the user bucket to be untouched, has %v tokens", got)
+	}
+}
+
+func TestRateLimiterTake_CostAboveBurst(t *testing.T) {
+	l := &rateLimiter{buckets: map[string]*tokenBucket{}}
+	checks := []rateLimitCheck{{key: "user", limit: rateLimit{Burst: 60, Period: time.Minute}}}
+
+	if _, err := l.take(time.Now(), checks, 61); !errors.Is(err, errRateLimitCost) {
+		t.Fatalf("expected errRateLimitCost, got %v", err)
+	}
+	if _, ok := l.buckets["user"]; ok {
+		t.Error("expected no bucket to be charged")
+	}
+}
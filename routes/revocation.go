@@ -0,0 +1,265 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"relay-control-plane/cwt"
+)
+
+func RegisterRevocationRoutes(se *core.ServeEvent) {
+	se.Router.POST("/api/tokens/revoke", handleRevokeTokens).Bind(apis.RequireAuth())
+	se.Router.GET("/api/revocations", handleRevocationList).BindFunc(requireProviderAuth)
+
+	se.App.Cron().MustAdd("deleteExpiredIssuedTokens", "30 * * * *", func() {
+		if err := deleteExpiredIssuedTokens(se.App); err != nil {
+			se.App.Logger().Error("Failed to delete expired issued tokens", "error", err)
+		}
+	})
+}
+
+// deleteExpiredIssuedTokens removes ledger entries for tokens that can no
+// longer be used or refreshed. Relays reject them on expiry, so they also
+// no longer need to appear in the revocation feed.
+func deleteExpiredIssuedTokens(app core.App) error {
+	expired, err := app.FindRecordsByFilter(
+		"issued_tokens",
+		"expires_at <= {:cutoff}",
+		"", 0, 0,
+		dbx.Params{"cutoff": types.NowDateTime().Add(-tokenRefreshGrace).String()},
+	)
+	if err != nil {
+		return err
+	}
+	for _, token := range expired {
+		if err := app.Delete(token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordIssuedToken adds a token to the issued_tokens ledger.
+func recordIssuedToken(app core.App, claims cwt.Claims, ra *relayAuth) error {
+	col, err := app.FindCollectionByNameOrId("issued_tokens")
+	if err != nil {
+		return err
+	}
+
+	rec := core.NewRecord(col)
+	rec.Set("jti", claims.ID)
+	if ra.APIKey != nil {
+		rec.Set("api_key", ra.APIKey.Id)
+	} else {
+		rec.Set("user", claims.Subject)
+	}
+	rec.Set("relay", ra.Relay.Id)
+	rec.Set("provider", ra.Provider.Id)
+	if ra.Folder != nil {
+		rec.Set("folder", ra.Folder.Id)
+	}
+	rec.Set("scope", cwt.FormatScopes(claims.Scopes))
+	rec.Set("expires_at", claims.ExpiresAt)
+	return app.Save(rec)
+}
+
+// revokeTokens revokes every outstanding ledger entry matching filter and
+// returns how many were revoked. Expired and already revoked tokens are skipped.
+func revokeTokens(app core.App, filter string, params dbx.Params) (int, error) {
+	now := types.NowDateTime()
+	params["now"] = now.String()
+
+	records, err := app.FindRecordsByFilter(
+		"issued_tokens",
+		"("+filter+") && revoked = false && expires_at > {:now}",
+		"", 0, 0,
+		params,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		for _, rec := range records {
+			rec.Set("revoked", true)
+			rec.Set("revoked_at", now)
+			if err := txApp.Save(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+// onRelayRoleUpdate revokes a user's outstanding tokens for a relay when a
+// role change lowers their authorization level, so they can't keep writing
+// with tokens issued under the old role. API keys they created with a role
+// their new one can't grant are revoked too.
+func onRelayRoleUpdate(e *core.RecordEvent) error {
+	before := authorizationForRole(e.App, e.Record.Original().GetString("role"))
+	if err := e.Next(); err != nil {
+		return err
+	}
+
+	userID := e.Record.GetString("user")
+	relayID := e.Record.GetString("relay")
+	if before == "full" && authorizationForRole(e.App, e.Record.GetString("role")) != "full" {
+		if _, err := revokeTokens(e.App, "user = {:user} && relay = {:relay}", dbx.Params{
+			"user":  userID,
+			"relay": relayID,
+		}); err != nil {
+			return err
+		}
+	}
+	return revokeUngrantableAPIKeys(e.App, relayID, userID)
+}
+
+// onRelayRoleDelete revokes a user's outstanding tokens for a relay when
+// their membership is removed, along with the API keys they created for it,
+// which would otherwise keep minting tokens at the role they granted.
+func onRelayRoleDelete(e *core.RecordEvent) error {
+	if err := e.Next(); err != nil {
+		return err
+	}
+
+	userID := e.Record.GetString("user")
+	relayID := e.Record.GetString("relay")
+	if _, err := revokeTokens(e.App, "user = {:user} && relay = {:relay}", dbx.Params{
+		"user":  userID,
+		"relay": relayID,
+	}); err != nil {
+		return err
+	}
+	return revokeUngrantableAPIKeys(e.App, relayID, userID)
+}
+
+// revokeUngrantableAPIKeys revokes the API keys a user created on a relay
+// whose role they can no longer grant, which is all of them once they have
+// left the relay.
+func revokeUngrantableAPIKeys(app core.App, relayID string, userID string) error {
+	keys, err := app.FindAllRecords("api_keys", dbx.HashExp{"relay": relayID, "created_by": userID, "revoked": false})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if canGrantRole(app, userID, relayID, key.GetString("role")) {
+			continue
+		}
+		if _, err := revokeAPIKey(app, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleRevokeTokens revokes a single token (jti), a user's tokens for a relay,
+// or all tokens for a relay. Users may always revoke their own tokens; members
+// whose role grants manage_members may revoke any token for their relay.
+func handleRevokeTokens(e *core.RequestEvent) error {
+	var body struct {
+		Jti   string `json:"jti"`
+		User  string `json:"user"`
+		Relay string `json:"relay"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid request body", nil)
+	}
+
+	var filter string
+	params := dbx.Params{}
+
+	switch {
+	case body.Jti != "":
+		rec, err := e.App.FindFirstRecordByFilter("issued_tokens", "jti = {:jti}", dbx.Params{"jti": body.Jti})
+		if err != nil {
+			return e.NotFoundError("Token not found", nil)
+		}
+		if rec.GetString("user") != e.Auth.Id && !hasRelayCapability(e.App, e.Auth.Id, rec.GetString("relay"), capManageMembers) {
+			return e.ForbiddenError("Not allowed to revoke this token", nil)
+		}
+		filter = "jti = {:jti}"
+		params["jti"] = body.Jti
+
+	case body.Relay != "":
+		relay, err := findRelay(e.App, body.Relay)
+		if err != nil {
+			return e.NotFoundError("Relay not found", nil)
+		}
+		if body.User != e.Auth.Id && !hasRelayCapability(e.App, e.Auth.Id, relay.Id, capManageMembers) {
+			return e.ForbiddenError("Not allowed to revoke other members' tokens", nil)
+		}
+		filter = "relay = {:relay}"
+		params["relay"] = relay.Id
+		if body.User != "" {
+			filter += " && user = {:user}"
+			params["user"] = body.User
+		}
+
+	case body.User != "":
+		if body.User != e.Auth.Id {
+			return e.ForbiddenError("Specify a relay to revoke another user's tokens", nil)
+		}
+		filter = "user = {:user}"
+		params["user"] = body.User
+
+	default:
+		return e.BadRequestError("One of jti, user or relay is required", nil)
+	}
+
+	n, err := revokeTokens(e.App, filter, params)
+	if err != nil {
+		return e.InternalServerError("Failed to revoke tokens", nil)
+	}
+
+	return e.JSON(200, map[string]any{"revoked": n})
+}
+
+// handleRevocationList returns the unexpired revoked tokens for the calling
+// provider's relays. Relays poll it with If-Modified-Since and get a 304 when
+// nothing has been revoked since their last fetch.
+func handleRevocationList(e *core.RequestEvent) error {
+	provider := authenticatedProvider(e)
+
+	records, err := e.App.FindRecordsByFilter(
+		"issued_tokens",
+		"provider = {:provider} && revoked = true && expires_at > {:now}",
+		"-revoked_at", 0, 0,
+		dbx.Params{"provider": provider.Id, "now": types.NowDateTime().String()},
+	)
+	if err != nil {
+		return e.InternalServerError("Failed to load revocations", nil)
+	}
+
+	var lastModified time.Time
+	revoked := make([]map[string]any, 0, len(records))
+	for _, rec := range records {
+		revokedAt := rec.GetDateTime("revoked_at").Time()
+		if revokedAt.After(lastModified) {
+			lastModified = revokedAt
+		}
+		revoked = append(revoked, map[string]any{
+			"jti":       rec.GetString("jti"),
+			"exp":       rec.GetDateTime("expires_at").Time().Unix(),
+			"revokedAt": revokedAt.Unix(),
+		})
+	}
+
+	if !lastModified.IsZero() {
+		lastModified = lastModified.UTC().Truncate(time.Second)
+		if ims, err := http.ParseTime(e.Request.Header.Get("If-Modified-Since")); err == nil && !lastModified.After(ims) {
+			return e.NoContent(http.StatusNotModified)
+		}
+		e.Response.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+
+	return e.JSON(200, map[string]any{"revoked": revoked})
+}
@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Built-in roles, used only to assign a role. Authorization checks go
+// through role capabilities.
+const (
+	ownerRoleID  = "2arnubkcv7jpce8"
+	memberRoleID = "x6lllh2qsf9lxk6"
+)
+
+// Capabilities a role can grant, stored in roles.capabilities.
+const (
+	capIssueRWToken  = "issue_rw_token" // tokens get full authorization
+	capManageMembers = "manage_members" // roles, removals, access requests, API keys, relay settings
+	capManageInvites = "manage_invites" // invite links and emailed invitations
+	capDeleteRelay   = "delete_relay"   // delete the relay and transfer ownership
+	capManageFolders = "manage_folders" // create, rename and delete shared folders
+)
+
+// roleCapabilities returns the capabilities a role grants. Unknown roles
+// grant nothing.
+func roleCapabilities(app core.App, roleID string) []string {
+	role, err := app.FindRecordById("roles", roleID)
+	if err != nil {
+		return nil
+	}
+	return role.GetStringSlice("capabilities")
+}
+
+func roleHasCapability(app core.App, roleID string, capability string) bool {
+	return slices.Contains(roleCapabilities(app, roleID), capability)
+}
+
+// hasRelayCapability reports whether the user's role on the relay grants
+// capability.
+func hasRelayCapability(app core.App, userID string, relayID string, capability string) bool {
+	membership, err := findMembership(app, relayID, userID)
+	if err != nil {
+		return false
+	}
+	return roleHasCapability(app, membership.GetString("role"), capability)
+}
+
+// canGrantRole reports whether the user's role on the relay has every
+// capability of roleID, so members can't hand out, or take away, more than
+// they hold themselves.
+func canGrantRole(app core.App, userID string, relayID string, roleID string) bool {
+	membership, err := findMembership(app, relayID, userID)
+	if err != nil {
+		return false
+	}
+	held := roleCapabilities(app, membership.GetString("role"))
+	for _, capability := range roleCapabilities(app, roleID) {
+		if !slices.Contains(held, capability) {
+			return false
+		}
+	}
+	return true
+}
+
+// relayMembersWithCapability returns the relay_roles entries of a relay whose
+// role grants capability.
+func relayMembersWithCapability(app core.App, relayID string, capability string) ([]*core.Record, error) {
+	memberships, err := app.FindAllRecords("relay_roles", dbx.HashExp{"relay": relayID})
+	if err != nil {
+		return nil, err
+	}
+	var matching []*core.Record
+	for _, m := range memberships {
+		if roleHasCapability(app, m.GetString("role"), capability) {
+			matching = append(matching, m)
+		}
+	}
+	return matching, nil
+}
+
+// relayWithCapability loads the relay named by the {relay} path parameter and
+// checks that the caller's role on it grants capability. forbidden is the
+// message used when it doesn't.
+func relayWithCapability(e *core.RequestEvent, capability string, forbidden string) (*core.Record, error) {
+	relay, err := findRelay(e.App, e.Request.PathValue("relay"))
+	if err != nil {
+		return nil, e.NotFoundError("Relay not found", nil)
+	}
+	if !hasRelayCapability(e.App, e.Auth.Id, relay.Id, capability) {
+		return nil, e.ForbiddenError(forbidden, nil)
+	}
+	return relay, nil
+}
+
+// roleNotGrantableError is the 403 returned when a member tries to grant or
+// change a role with capabilities they don't hold.
+func roleNotGrantableError(e *core.RequestEvent) error {
+	return e.ForbiddenError("Not allowed to grant this role", nil)
+}
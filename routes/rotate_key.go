@@ -4,7 +4,6 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 
-	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 )
@@ -27,13 +26,8 @@ func handleRotateKey(e *core.RequestEvent) error {
 	}
 
 	relayID := invitation.GetString("relay")
-	_, err = e.App.FindFirstRecordByFilter(
-		"relay_roles",
-		"user = {:user} && relay = {:relay} && role = {:role}",
-		dbx.Params{"user": e.Auth.Id, "relay": relayID, "role": ownerRoleID},
-	)
-	if err != nil {
-		return e.ForbiddenError("Only relay owners can rotate keys", nil)
+	if !hasRelayCapability(e.App, e.Auth.Id, relayID, capManageInvites) {
+		return e.ForbiddenError("Not allowed to rotate keys for this relay", nil)
 	}
 
 	newKey, err := generateRandomHex(16)
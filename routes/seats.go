@@ -0,0 +1,137 @@
+package routes
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+var errNoSeats = errors.New("relay has no free seats")
+
+func RegisterSeatRoutes(se *core.ServeEvent) {
+	se.Router.GET("/api/relays/{relay}/seats", handleSeatUsage).Bind(apis.RequireAuth())
+}
+
+// seatUsage describes how many members a relay may have and how many seats
+// are taken. A zero Limit means the relay is unlimited.
+type seatUsage struct {
+	Limit        int
+	Used         int
+	Source       string
+	ReadOnlyFree bool
+}
+
+func (s seatUsage) full() bool {
+	return s.Limit > 0 && s.Used >= s.Limit
+}
+
+func handleSeatUsage(e *core.RequestEvent) error {
+	relay, err := relayWithCapability(e, capManageMembers, "Not allowed to view seat usage for this relay")
+	if err != nil {
+		return err
+	}
+
+	usage, err := relaySeatUsage(e.App, relay)
+	if err != nil {
+		return e.InternalServerError("Failed to count seats", nil)
+	}
+
+	var available any // null for unlimited relays
+	if usage.Limit > 0 {
+		available = max(usage.Limit-usage.Used, 0)
+	}
+	return e.JSON(200, map[string]any{
+		"limit":        usage.Limit,
+		"used":         usage.Used,
+		"available":    available,
+		"source":       usage.Source,
+		"readOnlyFree": usage.ReadOnlyFree,
+	})
+}
+
+// relaySeatUsage counts a relay's seats. The seat limit comes from the
+// relay's active subscription quantity, falling back to relays.user_limit.
+// With RELAY_FREE_READ_ONLY_SEATS=true, members whose role only grants
+// read-only access don't take a seat.
+func relaySeatUsage(app core.App, relay *core.Record) (seatUsage, error) {
+	usage := seatUsage{ReadOnlyFree: readOnlySeatsFree()}
+
+	if quantity, ok := subscriptionSeats(app, relay.Id); ok {
+		usage.Limit = quantity
+		usage.Source = "subscription"
+	} else if limit := relay.GetInt("user_limit"); limit > 0 {
+		usage.Limit = limit
+		usage.Source = "user_limit"
+	} else {
+		usage.Source = "none"
+	}
+
+	memberships, err := app.FindAllRecords("relay_roles", dbx.HashExp{"relay": relay.Id})
+	if err != nil {
+		return usage, err
+	}
+	for _, m := range memberships {
+		if roleTakesSeat(app, m.GetString("role")) {
+			usage.Used++
+		}
+	}
+	return usage, nil
+}
+
+// ensureSeatAvailable returns errNoSeats if adding a member with roleID
+// would exceed the relay's seat limit.
+func ensureSeatAvailable(app core.App, relay *core.Record, roleID string) error {
+	if !roleTakesSeat(app, roleID) {
+		return nil
+	}
+	usage, err := relaySeatUsage(app, relay)
+	if err != nil {
+		return err
+	}
+	if usage.full() {
+		return errNoSeats
+	}
+	return nil
+}
+
+// subscriptionSeats returns the seat quantity of the relay's active
+// subscription, if it has one.
+func subscriptionSeats(app core.App, relayID string) (int, bool) {
+	subs, err := app.FindAllRecords("subscriptions", dbx.HashExp{"relay": relayID, "active": true})
+	if err != nil {
+		return 0, false
+	}
+	now := time.Now().Unix()
+	for _, sub := range subs {
+		cancelAt := int64(sub.GetInt("stripe_cancel_at"))
+		if cancelAt != 0 && cancelAt <= now {
+			continue
+		}
+		if quantity := sub.GetInt("stripe_quantity"); quantity > 0 {
+			return quantity, true
+		}
+	}
+	return 0, false
+}
+
+func roleTakesSeat(app core.App, roleID string) bool {
+	return !readOnlySeatsFree() || authorizationForRole(app, roleID) == "full"
+}
+
+func readOnlySeatsFree() bool {
+	free, _ := strconv.ParseBool(os.Getenv("RELAY_FREE_READ_ONLY_SEATS"))
+	return free
+}
+
+// seatLimitError is the 403 returned when a relay has no free seats.
+func seatLimitError(e *core.RequestEvent) error {
+	return e.ForbiddenError("This relay has reached its seat limit", map[string]validation.Error{
+		"relay": validation.NewError("seat_limit_reached", "This relay has reached its seat limit"),
+	})
+}
@@ -1,7 +1,6 @@
 package routes
 
 import (
-	"crypto/rand"
 	"encoding/base64"
 	"fmt"
 	"net/url"
@@ -10,6 +9,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
+
+	"relay-control-plane/cwt"
 )
 
 func RegisterSelfHostRoutes(se *core.ServeEvent) {
@@ -20,6 +21,8 @@ func handleSelfHost(e *core.RequestEvent) error {
 	var body struct {
 		URL      string `json:"url"`
 		Provider string `json:"provider"`
+		KeyType  string `json:"keyType"`
+		MACAlg   int64  `json:"macAlg"`
 	}
 	if err := e.BindBody(&body); err != nil {
 		return e.BadRequestError("Invalid request body", nil)
@@ -28,10 +31,25 @@ func handleSelfHost(e *core.RequestEvent) error {
 	var provider *core.Record
 
 	if body.URL != "" {
-		// Create a new self-hosted provider
-		hmacKey := make([]byte, 32)
-		if _, err := rand.Read(hmacKey); err != nil {
-			return e.InternalServerError("Failed to generate HMAC key", nil)
+		// Create a new self-hosted provider with its own signing key
+		keyType, err := cwt.ParseKeyType(body.KeyType)
+		if err != nil {
+			return e.BadRequestError("Unsupported key type", nil)
+		}
+		if body.MACAlg != 0 && (keyType != cwt.KeyTypeHMAC || !cwt.IsMACAlgorithm(body.MACAlg)) {
+			return e.BadRequestError("Unsupported MAC algorithm", nil)
+		}
+		key, err := cwt.GenerateKey(fmt.Sprintf("self_host_%d", time.Now().Unix()), keyType)
+		if err != nil {
+			return e.InternalServerError("Failed to generate signing key", nil)
+		}
+		publicKey, err := recordPublicKey(key)
+		if err != nil {
+			return e.InternalServerError("Failed to encode signing key", nil)
+		}
+		apiSecret, err := generateRandomHex(32)
+		if err != nil {
+			return e.InternalServerError("Failed to generate provider secret", nil)
 		}
 
 		provCol, err := e.App.FindCollectionByNameOrId("providers")
@@ -42,9 +60,16 @@ func handleSelfHost(e *core.RequestEvent) error {
 		provider = core.NewRecord(provCol)
 		provider.Set("url", body.URL)
 		provider.Set("self_hosted", true)
-		provider.Set("public_key", base64.StdEncoding.EncodeToString(hmacKey))
-		provider.Set("key_id", fmt.Sprintf("self_host_%d", time.Now().Unix()))
-		provider.Set("key_type", "hmac")
+		provider.Set("public_key", publicKey)
+		provider.Set("key_id", key.ID)
+		provider.Set("key_type", string(key.Type))
+		provider.Set("api_secret", apiSecret)
+		provider.Set("mac_alg", body.MACAlg)
+		privateKey, err := key.MarshalPrivateKey()
+		if err != nil {
+			return e.InternalServerError("Failed to encode signing key", nil)
+		}
+		provider.Set("private_key", base64.StdEncoding.EncodeToString(privateKey))
 
 		parsed, err := url.Parse(body.URL)
 		if err == nil && parsed.Host != "" {
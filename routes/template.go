@@ -3,14 +3,17 @@ package routes
 import (
 	"bytes"
 	"os"
+	"strconv"
 	"text/template"
 
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
+
+	"relay-control-plane/cwt"
 )
 
 func RegisterTemplateRoutes(se *core.ServeEvent) {
-	se.Router.GET("/templates/relay.toml", handleRelayToml).Bind(apis.RequireAuth())
+	se.Router.GET("/templates/relay.toml", handleRelayToml).Bind(apis.RequireSuperuserAuth())
 	se.Router.GET("/api/collections/relays/records/{id}/relay.toml", handleRelayToml).Bind(apis.RequireAuth())
 }
 
@@ -25,16 +28,46 @@ func handleRelayToml(e *core.RequestEvent) error {
 		return e.InternalServerError("Invalid template", nil)
 	}
 
-	publicKey := os.Getenv("RELAY_HMAC_KEY")
-	if publicKey == "" {
-		publicKey = "<HMAC_KEY_BASE64>"
+	keys, provider, withSecrets, err := relayTomlKeys(e)
+	if err != nil {
+		return err
+	}
+
+	authKeys := make([]map[string]string, 0, len(keys))
+	for _, key := range keys {
+		publicKey := "<SHARED_SECRET_BASE64>"
+		if withSecrets || !key.Type.Symmetric() {
+			publicKey, err = encodePublicKey(key)
+			if err != nil {
+				return e.InternalServerError("Failed to encode key", nil)
+			}
+		}
+		authKey := map[string]string{"KeyID": key.ID}
+		if key.Type == cwt.KeyTypeA256GCM {
+			authKey["DecryptionKey"] = publicKey
+		} else {
+			authKey["PublicKey"] = publicKey
+		}
+		if key.MACAlgorithm != 0 {
+			authKey["MACAlgorithm"] = strconv.FormatInt(key.MACAlgorithm, 10)
+		}
+		authKeys = append(authKeys, authKey)
+	}
+	if len(authKeys) == 0 {
+		authKeys = append(authKeys, map[string]string{
+			"KeyID":     getKeyID(),
+			"PublicKey": "<PUBLIC_KEY_BASE64>",
+		})
 	}
 
-	data := map[string]string{
-		"URL":       "{url}",
-		"KeyID":     getHMACKeyID(),
-		"PublicKey": publicKey,
-		"Issuer":    getIssuer(),
+	data := map[string]any{
+		"URL":    "{url}",
+		"Keys":   authKeys,
+		"Issuer": getIssuer(),
+	}
+	if provider != nil {
+		data["ProviderID"] = provider.Id
+		data["ProviderSecret"] = provider.GetString("api_secret")
 	}
 
 	var buf bytes.Buffer
@@ -44,3 +77,48 @@ func handleRelayToml(e *core.RequestEvent) error {
 
 	return e.Blob(200, "text/plain", buf.Bytes())
 }
+
+// relayTomlKeys returns the keys a relay should accept, and whether symmetric
+// secrets may be rendered. Only superusers and members with manage_members
+// may see a relay's configuration.
+//
+// Self-hosted relays validate with their provider's own key, and the provider
+// record is returned so its credentials can be rendered too. All other relays
+// get the global keyring with their provider's MAC algorithm applied. Its
+// symmetric secrets can mint tokens for every default relay, so they are
+// only shown to superusers.
+func relayTomlKeys(e *core.RequestEvent) ([]cwt.Key, *core.Record, bool, error) {
+	superuser := e.HasSuperuserAuth()
+
+	var provider *core.Record
+	relayID := e.Request.PathValue("id")
+	if relayID != "" {
+		relay, err := e.App.FindRecordById("relays", relayID)
+		if err != nil {
+			return nil, nil, false, e.NotFoundError("Relay not found", nil)
+		}
+		if !superuser && !hasRelayCapability(e.App, e.Auth.Id, relay.Id, capManageMembers) {
+			return nil, nil, false, e.ForbiddenError("Not allowed to view this configuration", nil)
+		}
+
+		provider, err = e.App.FindRecordById("providers", relay.GetString("provider"))
+		if err == nil && provider.GetBool("self_hosted") {
+			key, err := providerSigningKey(e.App, provider)
+			if err != nil {
+				return nil, nil, false, e.InternalServerError("Provider key not configured", nil)
+			}
+			return []cwt.Key{key}, provider, true, nil
+		}
+	}
+
+	keys, err := validSigningKeys(e.App)
+	if err != nil {
+		return nil, nil, false, e.InternalServerError("Failed to load keys", nil)
+	}
+	if provider != nil {
+		for i, key := range keys {
+			keys[i] = withProviderMACAlgorithm(key, provider)
+		}
+	}
+	return keys, nil, superuser, nil
+}
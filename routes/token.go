@@ -4,15 +4,18 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"time"
 
-	"github.com/pocketbase/pocketbase/apis"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/pocketbase/pocketbase/core"
 
 	"relay-control-plane/cwt"
 )
 
 func RegisterTokenRoutes(se *core.ServeEvent) {
-	se.Router.POST("/token", handleToken).Bind(apis.RequireAuth())
+	se.Router.POST("/token", handleToken).
+		BindFunc(requireUserOrAPIKey).
+		BindFunc(requireRateLimit(se.App, tokenRateLimits, nil))
 }
 
 func getWSScheme() string {
@@ -49,12 +52,18 @@ func buildProviderURLs(providerURL string) (wsURL string, httpURL string, err er
 	return wsURL, httpURL, nil
 }
 
+// docTokenRequest is the /token request body. Files optionally lists the
+// hashes of files embedded in the document; the returned token then also
+// covers those files.
+type docTokenRequest struct {
+	DocID  string   `json:"docId"`
+	Relay  string   `json:"relay"`
+	Folder string   `json:"folder"`
+	Files  []string `json:"files"`
+}
+
 func handleToken(e *core.RequestEvent) error {
-	var body struct {
-		DocID  string `json:"docId"`
-		Relay  string `json:"relay"`
-		Folder string `json:"folder"`
-	}
+	var body docTokenRequest
 	if err := e.BindBody(&body); err != nil {
 		return e.BadRequestError("Invalid request body", nil)
 	}
@@ -63,31 +72,122 @@ func handleToken(e *core.RequestEvent) error {
 	if err != nil {
 		return err
 	}
+	if err := takeRelayRateLimit(e, tokenRateLimits, ra.Relay.Id, 1); err != nil {
+		return err
+	}
+	ra, err = resolveFolderAuth(e, ra, body.Folder)
+	if err != nil {
+		return err
+	}
 
-	key, err := getHMACKey()
+	resp, err := mintDocToken(e, ra, body)
 	if err != nil {
-		return e.InternalServerError("HMAC key not configured", nil)
+		return err
 	}
-	keyID := getHMACKeyID()
-	issuer := getIssuer()
+	return e.JSON(200, resp)
+}
 
-	const expirySeconds = 3600
-	token, err := cwt.GenerateDocToken(key, keyID, issuer, body.DocID, e.Auth.Id, ra.ProviderURL, ra.Authorization, expirySeconds)
+// mintDocToken issues a document token and builds the /token response body.
+func mintDocToken(e *core.RequestEvent, ra *relayAuth, req docTokenRequest) (map[string]any, error) {
+	expirySeconds := tokenTTL(e.App, ra, tokenKindDoc)
+	scopes := []cwt.Scope{cwt.DocScope(req.DocID, ra.Authorization)}
+	for _, hash := range req.Files {
+		scopes = append(scopes, cwt.FileScope(hash, req.DocID, ra.Authorization))
+	}
+	token, err := issueToken(e, ra, scopeToFolder(ra, scopes), expirySeconds)
 	if err != nil {
-		return e.InternalServerError("Failed to generate token", nil)
+		return nil, err
 	}
 
 	wsURL, httpURL, err := buildProviderURLs(ra.ProviderURL)
 	if err != nil {
-		return e.InternalServerError("Invalid provider URL", nil)
+		return nil, e.InternalServerError("Invalid provider URL", nil)
 	}
 
-	return e.JSON(200, map[string]any{
-		"url":           fmt.Sprintf("%s/d/%s/ws", wsURL, body.DocID),
-		"baseUrl":       fmt.Sprintf("%s/d/%s", httpURL, body.DocID),
-		"docId":         body.DocID,
+	resp := map[string]any{
+		"url":           fmt.Sprintf("%s/d/%s/ws", wsURL, req.DocID),
+		"baseUrl":       fmt.Sprintf("%s/d/%s", httpURL, req.DocID),
+		"docId":         req.DocID,
 		"token":         token,
 		"authorization": ra.Authorization,
 		"expiryTime":    expiryTime(expirySeconds),
-	})
+	}
+	if len(req.Files) > 0 {
+		resp["files"] = req.Files
+	}
+	return resp, nil
+}
+
+// scopeToFolder limits doc and file scopes to the shared folder ra was
+// authorized for, so relays can check each document belongs to it and a
+// private folder's documents can't be reached by naming another folder.
+func scopeToFolder(ra *relayAuth, scopes []cwt.Scope) []cwt.Scope {
+	if ra.Folder == nil {
+		return scopes
+	}
+	for i, scope := range scopes {
+		scopes[i] = scope.InFolder(ra.Folder.GetString("guid"))
+	}
+	return scopes
+}
+
+// issueToken signs a token covering scopes for the authenticated user with
+// the relay's provider key and records it in the issued_tokens ledger for
+// revocation.
+func issueToken(e *core.RequestEvent, ra *relayAuth, scopes []cwt.Scope, expirySeconds int) (string, error) {
+	if err := validateScopes(e, scopes); err != nil {
+		return "", err
+	}
+
+	key, err := providerSigningKey(e.App, ra.Provider)
+	if err != nil {
+		return "", e.InternalServerError("Signing key not configured", nil)
+	}
+	token, err := signToken(e.App, key, ra, scopes, expirySeconds)
+	if err != nil {
+		return "", e.InternalServerError("Failed to generate token", nil)
+	}
+	return token, nil
+}
+
+// validateScopes returns a 400 for the first invalid scope.
+func validateScopes(e *core.RequestEvent, scopes []cwt.Scope) error {
+	for _, scope := range scopes {
+		if err := scope.Validate(); err != nil {
+			return e.BadRequestError("Invalid scope", validation.Errors{
+				"scope": validation.NewError("invalid_scope", err.Error()),
+			})
+		}
+	}
+	return nil
+}
+
+// signToken signs a token for ra.Subject with key and records it in the
+// issued_tokens ledger. Scopes must already be validated.
+func signToken(app core.App, key cwt.Key, ra *relayAuth, scopes []cwt.Scope, expirySeconds int) (string, error) {
+	jti, err := cwt.NewTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := cwt.Claims{
+		ID:        jti,
+		Issuer:    getIssuer(),
+		Subject:   ra.Subject,
+		Audience:  ra.ProviderURL,
+		IssuedAt:  now,
+		NotBefore: now.Add(-tokenClockSkew),
+		ExpiresAt: now.Add(time.Duration(expirySeconds) * time.Second),
+		Scopes:    scopes,
+	}
+	token, err := cwt.Issue(key, claims)
+	if err != nil {
+		return "", err
+	}
+
+	if err := recordIssuedToken(app, claims, ra); err != nil {
+		return "", fmt.Errorf("recording token: %w", err)
+	}
+	return token, nil
 }
@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"fmt"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+
+	"relay-control-plane/migrations"
+)
+
+// Token lifetimes, in seconds. Relays may override the default per token type
+// through their token policy, within the bounds the token_policies collection
+// enforces.
+const (
+	defaultTokenTTL = 3600
+	minTokenTTL     = migrations.MinTokenTTL
+	maxTokenTTL     = migrations.MaxTokenTTL
+)
+
+// tokenClockSkew backdates nbf and is allowed as leeway when verifying, so
+// relays whose clocks lag slightly behind still accept fresh tokens.
+const tokenClockSkew = 30 * time.Second
+
+type tokenKind string
+
+const (
+	tokenKindDoc  tokenKind = "doc"
+	tokenKindFile tokenKind = "file"
+)
+
+func RegisterTokenPolicyRoutes(se *core.ServeEvent) {
+	g := se.Router.Group("/api/relays/{relay}/token-policy")
+	g.Bind(apis.RequireAuth())
+	g.GET("", handleGetTokenPolicy)
+	g.PUT("", handleUpdateTokenPolicy)
+}
+
+// tokenPolicy holds a relay's token lifetimes. Zero means "use the default".
+type tokenPolicy struct {
+	DocTTL      int `json:"docTtl"`
+	FileTTL     int `json:"fileTtl"`
+	ReadOnlyTTL int `json:"readOnlyTtl"`
+}
+
+// tokenTTL returns the lifetime in seconds for a token of the given kind.
+// Read-only tokens use the policy's read-only TTL when one is set.
+func tokenTTL(app core.App, ra *relayAuth, kind tokenKind) int {
+	policy := loadTokenPolicy(app, ra.Relay.Id)
+
+	if ra.Authorization != "full" && policy.ReadOnlyTTL > 0 {
+		return policy.ReadOnlyTTL
+	}
+	ttl := policy.DocTTL
+	if kind == tokenKindFile {
+		ttl = policy.FileTTL
+	}
+	if ttl <= 0 {
+		return defaultTokenTTL
+	}
+	return ttl
+}
+
+// loadTokenPolicy returns the relay's token policy, or an empty policy when
+// none has been set.
+func loadTokenPolicy(app core.App, relayID string) tokenPolicy {
+	rec, err := findTokenPolicyRecord(app, relayID)
+	if err != nil {
+		return tokenPolicy{}
+	}
+	return tokenPolicy{
+		DocTTL:      rec.GetInt("doc_ttl"),
+		FileTTL:     rec.GetInt("file_ttl"),
+		ReadOnlyTTL: rec.GetInt("read_only_ttl"),
+	}
+}
+
+func findTokenPolicyRecord(app core.App, relayID string) (*core.Record, error) {
+	return app.FindFirstRecordByFilter("token_policies", "relay = {:relay}", dbx.Params{"relay": relayID})
+}
+
+func handleGetTokenPolicy(e *core.RequestEvent) error {
+	ra, err := resolveRelayAuth(e, e.Request.PathValue("relay"))
+	if err != nil {
+		return err
+	}
+	return e.JSON(200, tokenPolicyResponse(e.App, ra.Relay.Id))
+}
+
+// handleUpdateTokenPolicy replaces a relay's token policy. It requires the
+// manage_members capability; a zero TTL resets that token type to the default.
+func handleUpdateTokenPolicy(e *core.RequestEvent) error {
+	relay, err := findRelay(e.App, e.Request.PathValue("relay"))
+	if err != nil {
+		return e.NotFoundError("Relay not found", nil)
+	}
+	if !hasRelayCapability(e.App, e.Auth.Id, relay.Id, capManageMembers) {
+		return e.ForbiddenError("Not allowed to change the token policy for this relay", nil)
+	}
+
+	var body tokenPolicy
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid request body", nil)
+	}
+	if errs := body.validate(); len(errs) > 0 {
+		return e.BadRequestError("Invalid token policy", errs)
+	}
+
+	rec, err := findTokenPolicyRecord(e.App, relay.Id)
+	if err != nil {
+		col, err := e.App.FindCollectionByNameOrId("token_policies")
+		if err != nil {
+			return e.InternalServerError("Failed to save token policy", nil)
+		}
+		rec = core.NewRecord(col)
+		rec.Set("relay", relay.Id)
+	}
+	rec.Set("doc_ttl", body.DocTTL)
+	rec.Set("file_ttl", body.FileTTL)
+	rec.Set("read_only_ttl", body.ReadOnlyTTL)
+	if err := e.App.Save(rec); err != nil {
+		return e.InternalServerError("Failed to save token policy", nil)
+	}
+
+	return e.JSON(200, tokenPolicyResponse(e.App, relay.Id))
+}
+
+func (p tokenPolicy) validate() validation.Errors {
+	errs := validation.Errors{}
+	for field, ttl := range map[string]int{
+		"docTtl":      p.DocTTL,
+		"fileTtl":     p.FileTTL,
+		"readOnlyTtl": p.ReadOnlyTTL,
+	} {
+		if ttl != 0 && (ttl < minTokenTTL || ttl > maxTokenTTL) {
+			errs[field] = validation.NewError(
+				"ttl_out_of_range",
+				fmt.Sprintf("Must be between %d and %d seconds, or 0 for the default", minTokenTTL, maxTokenTTL),
+			)
+		}
+	}
+	return errs
+}
+
+// tokenPolicyResponse returns the stored policy with the default and bounds
+// that apply to it.
+func tokenPolicyResponse(app core.App, relayID string) map[string]any {
+	return map[string]any{
+		"policy":     loadTokenPolicy(app, relayID),
+		"defaultTtl": defaultTokenTTL,
+		"bounds":     map[string]int{"min": minTokenTTL, "max": maxTokenTTL},
+	}
+}
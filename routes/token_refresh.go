@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"errors"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"relay-control-plane/cwt"
+)
+
+// tokenRefreshGrace is how long after expiry a token can still be refreshed.
+const tokenRefreshGrace = 5 * time.Minute
+
+func RegisterTokenRefreshRoutes(se *core.ServeEvent) {
+	se.Router.POST("/token/refresh", handleTokenRefresh).
+		Bind(apis.RequireAuth()).
+		BindFunc(requireRateLimit(se.App, tokenRateLimits, nil))
+}
+
+var errTokenAlreadyRefreshed = errors.New("token was already refreshed or revoked")
+
+// handleTokenRefresh exchanges a valid or recently expired token for a fresh
+// one with the same scopes. Relay and folder access are re-checked, so the
+// new token carries the user's current authorization level. The presented
+// token is revoked as the new one is recorded, so each token can only be
+// refreshed once.
+func handleTokenRefresh(e *core.RequestEvent) error {
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Invalid request body", nil)
+	}
+	if body.Token == "" {
+		return e.BadRequestError("token is required", nil)
+	}
+
+	// The kid picks the keys; claims of encrypted tokens are only readable
+	// once verified.
+	parsed, err := cwt.Parse(body.Token)
+	if err != nil {
+		return e.UnauthorizedError("Invalid token", nil)
+	}
+	keys, err := keyringForKeyID(e.App, parsed.KeyID)
+	if err != nil {
+		return e.InternalServerError("Signing key not configured", nil)
+	}
+	claims, err := cwt.Verify(body.Token, keys, cwt.VerifyOptions{
+		Issuer: getIssuer(),
+		Leeway: tokenRefreshGrace,
+	})
+	if errors.Is(err, cwt.ErrExpired) {
+		return e.UnauthorizedError("Token expired beyond the refresh window", nil)
+	}
+	if err != nil || claims.ID == "" {
+		return e.UnauthorizedError("Invalid token", nil)
+	}
+
+	issued, err := e.App.FindFirstRecordByFilter(
+		"issued_tokens",
+		"jti = {:jti}",
+		dbx.Params{"jti": claims.ID},
+	)
+	if err != nil || issued.GetBool("revoked") {
+		return e.UnauthorizedError("Invalid token", nil)
+	}
+	if issued.GetString("user") != e.Auth.Id {
+		return e.ForbiddenError("Token was issued to another user", nil)
+	}
+
+	ra, err := resolveRelayAuth(e, issued.GetString("relay"))
+	if err != nil {
+		return err
+	}
+	if err := takeRelayRateLimit(e, tokenRateLimits, ra.Relay.Id, 1); err != nil {
+		return err
+	}
+	ra, err = resolveFolderAuth(e, ra, issued.GetString("folder"))
+	if err != nil {
+		return err
+	}
+
+	kind := tokenKindFile
+	scopes := make([]cwt.Scope, len(claims.Scopes))
+	for i, scope := range claims.Scopes {
+		scopes[i] = scope.WithAuthorization(ra.Authorization)
+		if scope.Kind != string(tokenKindFile) {
+			kind = tokenKindDoc
+		}
+	}
+
+	if err := validateScopes(e, scopes); err != nil {
+		return err
+	}
+	key, err := providerSigningKey(e.App, ra.Provider)
+	if err != nil {
+		return e.InternalServerError("Signing key not configured", nil)
+	}
+
+	expirySeconds := tokenTTL(e.App, ra, kind)
+	var token string
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		previous, err := txApp.FindRecordById("issued_tokens", issued.Id)
+		if err != nil {
+			return err
+		}
+		if previous.GetBool("revoked") {
+			return errTokenAlreadyRefreshed
+		}
+		previous.Set("revoked", true)
+		previous.Set("revoked_at", types.NowDateTime())
+		if err := txApp.Save(previous); err != nil {
+			return err
+		}
+		token, err = signToken(txApp, key, ra, scopes, expirySeconds)
+		return err
+	})
+	if errors.Is(err, errTokenAlreadyRefreshed) {
+		return e.UnauthorizedError("Invalid token", nil)
+	}
+	if err != nil {
+		return e.InternalServerError("Failed to generate token", nil)
+	}
+
+	return e.JSON(200, map[string]any{
+		"token":         token,
+		"scope":         cwt.FormatScopes(scopes),
+		"authorization": ra.Authorization,
+		"expiryTime":    expiryTime(expirySeconds),
+	})
+}
@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 )
@@ -15,7 +14,9 @@ func RegisterUtilityRoutes(se *core.ServeEvent) {
 	se.Router.GET("/flags", handleFlags).Bind(apis.RequireAuth())
 	se.Router.GET("/whoami", handleWhoami).Bind(apis.RequireAuth())
 	se.Router.GET("/health", handleHealth)
-	se.Router.GET("/api/relay/{guid}/check-host", handleCheckHost).Bind(apis.RequireAuth())
+	se.Router.GET("/api/relay/{guid}/check-host", handleCheckHost).
+		Bind(apis.RequireAuth()).
+		BindFunc(requireRateLimit(se.App, checkHostRateLimits, nil))
 }
 
 func handleFlags(e *core.RequestEvent) error {
@@ -31,24 +32,15 @@ func handleHealth(e *core.RequestEvent) error {
 }
 
 func handleCheckHost(e *core.RequestEvent) error {
-	guid := e.Request.PathValue("guid")
-
-	relay, err := e.App.FindFirstRecordByFilter(
-		"relays",
-		"guid = {:guid}",
-		dbx.Params{"guid": guid},
-	)
+	ra, err := resolveRelayAuth(e, e.Request.PathValue("guid"))
 	if err != nil {
-		return e.NotFoundError("Relay not found", nil)
+		return err
 	}
-
-	providerID := relay.GetString("provider")
-	provider, err := e.App.FindRecordById("providers", providerID)
-	if err != nil {
-		return e.NotFoundError("Provider not found", nil)
+	if err := takeRelayRateLimit(e, checkHostRateLimits, ra.Relay.Id, 1); err != nil {
+		return err
 	}
 
-	providerURL := provider.GetString("url")
+	providerURL := ra.ProviderURL
 	httpScheme := "https"
 	if getWSScheme() == "ws" {
 		httpScheme = "http"